@@ -12,7 +12,7 @@ import { formatDate, todayYMD } from './lib/utils';
 // remove ai parse; use streaming chat
 import { SmartTaskInput } from './components/SmartTaskInput';
  
-import { getTodos, createTodo, toggleTodo, deleteTodo as apiDeleteTodo, getCalendar, toggleSubtask, updateTodo, addSubtask, deleteSubtask, updateSubtask } from './services/api';
+import { getTodos, createTodo, setTodoCompleted, deleteTodo as apiDeleteTodo, getCalendar, setSubtaskCompleted, updateTodo, addSubtask, deleteSubtask, updateSubtask } from './services/api';
 
 const App: React.FC = () => {
   // Initialize with today's date
@@ -67,10 +67,12 @@ const App: React.FC = () => {
 
   const toggleTask = async (id: string) => {
     if (!token) return;
-    const res = await toggleTodo(id, token);
+    const current = tasks.find(t => t.id === id) ?? allMonthTasks.find(t => t.id === id);
+    const res = await setTodoCompleted(id, !current?.completed, token);
     if (res.ok) {
-      setTasks(prev => prev.map(t => t.id === id ? { ...t, completed: !t.completed } : t));
-      setAllMonthTasks(prev => prev.map(t => t.id === id ? { ...t, completed: !t.completed } : t));
+      const completed = !!res.data?.completed;
+      setTasks(prev => prev.map(t => t.id === id ? { ...t, completed } : t));
+      setAllMonthTasks(prev => prev.map(t => t.id === id ? { ...t, completed } : t));
     } else { setToast(res.error || 'Toggle task failed'); }
   };
 
@@ -156,10 +158,13 @@ const askAi = async (text: string) => {
   const toggleSubtaskLocal = async (taskId: string, subtaskId: string) => {
     if (!token) return;
     try {
-      const res = await toggleSubtask(subtaskId, token);
+      const parent = tasks.find(t => t.id === taskId) ?? (editingTask?.id === taskId ? editingTask : undefined);
+      const current = parent?.subtasks?.find(st => st.id === subtaskId);
+      const res = await setSubtaskCompleted(subtaskId, !current?.completed, token);
       if (res.ok) {
-        setTasks(prev => prev.map(t => t.id === taskId ? { ...t, subtasks: (t.subtasks||[]).map(st => st.id === subtaskId ? { ...st, completed: !st.completed } : st) } : t));
-        setEditingTask(prev => prev && prev.id === taskId ? { ...prev, subtasks: (prev.subtasks||[]).map(st => st.id === subtaskId ? { ...st, completed: !st.completed } : st) } : prev);
+        const completed = !!res.data?.completed;
+        setTasks(prev => prev.map(t => t.id === taskId ? { ...t, subtasks: (t.subtasks||[]).map(st => st.id === subtaskId ? { ...st, completed } : st) } : t));
+        setEditingTask(prev => prev && prev.id === taskId ? { ...prev, subtasks: (prev.subtasks||[]).map(st => st.id === subtaskId ? { ...st, completed } : st) } : prev);
       } else { setToast(res.error || 'Toggle subtask failed'); }
     } catch (e:any) { setToast(e?.message || 'Toggle subtask error'); }
   };
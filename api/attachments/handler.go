@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"chronos-task-manager/pkg/attachments"
+	"chronos-task-manager/pkg/blob"
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+)
+
+// liveTodo limits attachments to those of live todos; attachments of trashed
+// todos come back when the todo is restored.
+const liveTodo = "todo_id IN (SELECT id FROM todos WHERE deleted_at IS NULL)"
+
+// Handler uploads (multipart POST with a "file" part and todoId), lists
+// (GET ?todoId=), downloads (GET ?id=) and deletes (DELETE ?id=) attachments.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "attachments GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	store, err := blob.FromEnv()
+	if err != nil {
+		slog.ErrorContext(ctx, "attachments store failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "storage not configured")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		if idStr := q.Get("id"); idStr != "" {
+			id, _ := strconv.ParseInt(idStr, 10, 64)
+			download(ctx, w, pool, store, c.UserID, id)
+			return
+		}
+		todoID, _ := strconv.ParseInt(q.Get("todoId"), 10, 64)
+		list, err := attachments.List(ctx, pool, "user_id=$1 AND todo_id=$2 AND "+liveTodo, c.UserID, todoID)
+		if err != nil {
+			slog.ErrorContext(ctx, "attachments list failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, list)
+	case http.MethodPost:
+		upload(ctx, w, r, pool, store, c.UserID)
+	case http.MethodDelete:
+		id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		n, err := attachments.Delete(ctx, pool, store, "user_id=$1 AND id=$2 AND "+liveTodo, c.UserID, id)
+		if err != nil {
+			slog.ErrorContext(ctx, "attachments delete failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if n == 0 {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpx.OK(w, nil)
+	default:
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func upload(ctx context.Context, w http.ResponseWriter, r *http.Request, pool *pgxpool.Pool, store blob.Store, userID int64) {
+	maxBytes := attachments.MaxBytes()
+	// Leave room for the multipart framing around the file.
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64<<10)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		httpx.Error(w, http.StatusBadRequest, "expected multipart/form-data")
+		return
+	}
+	todoID, _ := strconv.ParseInt(r.URL.Query().Get("todoId"), 10, 64)
+	var data []byte
+	var filename string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			httpx.Error(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("file larger than %d bytes", maxBytes))
+			return
+		}
+		if err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid multipart body")
+			return
+		}
+		switch part.FormName() {
+		case "todoId":
+			v, _ := io.ReadAll(io.LimitReader(part, 32))
+			todoID, _ = strconv.ParseInt(string(v), 10, 64)
+		case "file":
+			filename = attachments.CleanFilename(part.FileName())
+			data, err = io.ReadAll(io.LimitReader(part, maxBytes+1))
+			if errors.As(err, &tooBig) || int64(len(data)) > maxBytes {
+				httpx.Error(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("file larger than %d bytes", maxBytes))
+				return
+			}
+			if err != nil {
+				httpx.Error(w, http.StatusBadRequest, "invalid multipart body")
+				return
+			}
+		}
+		part.Close()
+	}
+	if todoID == 0 || data == nil {
+		httpx.Error(w, http.StatusBadRequest, "todoId and file are required")
+		return
+	}
+	if len(data) == 0 {
+		httpx.Error(w, http.StatusBadRequest, "file is empty")
+		return
+	}
+	contentType, ok := attachments.DetectType(data)
+	if !ok {
+		httpx.Error(w, http.StatusUnsupportedMediaType, "unsupported file type "+contentType)
+		return
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	// Serialize uploads per user so concurrent ones cannot both pass the
+	// quota check.
+	if err := db.LockUser(ctx, tx, db.LockAttachments, userID); err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	var owned bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM todos WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL)", todoID, userID).Scan(&owned); err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	if !owned {
+		httpx.Error(w, http.StatusNotFound, "todo not found")
+		return
+	}
+	used, err := attachments.Used(ctx, tx, userID)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	if quota := attachments.QuotaBytes(); used+int64(len(data)) > quota {
+		httpx.JSON(w, http.StatusInsufficientStorage, map[string]interface{}{"ok": false, "error": "attachment quota exceeded", "usedBytes": used, "quotaBytes": quota})
+		return
+	}
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "storage error")
+		return
+	}
+	key := fmt.Sprintf("%d/%d/%s", userID, todoID, hex.EncodeToString(suffix))
+	if err := store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		slog.ErrorContext(ctx, "attachments put failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "storage error")
+		return
+	}
+	a := attachments.Attachment{TodoID: todoID, Filename: filename, ContentType: contentType, Size: int64(len(data))}
+	err = tx.QueryRow(ctx, "INSERT INTO attachments(user_id,todo_id,filename,content_type,size_bytes,storage_key) VALUES($1,$2,$3,$4,$5,$6) RETURNING id,created_at",
+		userID, todoID, filename, contentType, a.Size, key).Scan(&a.ID, &a.CreatedAt)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "attachments insert failed", "err", err)
+		if derr := store.Delete(ctx, key); derr != nil {
+			slog.ErrorContext(ctx, "attachments cleanup failed", "err", derr)
+		}
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	httpx.OK(w, a)
+}
+
+func download(ctx context.Context, w http.ResponseWriter, pool *pgxpool.Pool, store blob.Store, userID, id int64) {
+	list, err := attachments.List(ctx, pool, "user_id=$1 AND id=$2 AND "+liveTodo, userID, id)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	if len(list) == 0 {
+		httpx.Error(w, http.StatusNotFound, "not found")
+		return
+	}
+	a := list[0]
+	rc, err := store.Get(ctx, a.StorageKey)
+	if errors.Is(err, blob.ErrNotFound) {
+		httpx.Error(w, http.StatusNotFound, "file missing from storage")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "attachments get failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "storage error")
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(a.Filename)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, rc); err != nil {
+		slog.ErrorContext(ctx, "attachments download failed", "err", err)
+	}
+}
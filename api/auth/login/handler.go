@@ -3,14 +3,18 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"golang.org/x/crypto/bcrypt"
 
 	"chronos-task-manager/pkg/auth"
 	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/logx"
 )
 
 type loginReq struct {
@@ -25,7 +29,10 @@ type loginResp struct {
 }
 
 func Handler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("login Handler invoked: method=%s path=%s", r.Method, r.URL.Path)
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		_ = json.NewEncoder(w).Encode(loginResp{OK: false, Error: "method not allowed"})
@@ -38,30 +45,39 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
-	ctx := context.Background()
+	ctx := context.WithoutCancel(r.Context())
 	pool, err := db.GetPool(ctx)
 	if err != nil {
-		log.Printf("login GetPool error: %v", err)
+		slog.ErrorContext(ctx, "login GetPool failed", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
-		_ = json.NewEncoder(w).Encode(loginResp{OK: false, Error: err.Error()})
+		_ = json.NewEncoder(w).Encode(loginResp{OK: false, Error: "db error"})
 		return
 	}
 	var id int64
 	var hash string
-	if err = pool.QueryRow(ctx, "SELECT id, password_hash FROM users WHERE email=$1", req.Email).Scan(&id, &hash); err != nil {
-		log.Printf("login select error: %v", err)
+	err = pool.QueryRow(ctx, "SELECT id, password_hash FROM users WHERE email=$1", req.Email).Scan(&id, &hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// An unknown email is an ordinary failed login, not a server error.
+		slog.InfoContext(ctx, "login unknown email")
 		w.WriteHeader(http.StatusUnauthorized)
 		_ = json.NewEncoder(w).Encode(loginResp{OK: false, Error: "invalid credentials"})
 		return
 	}
+	if err != nil {
+		slog.ErrorContext(ctx, "login select failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(loginResp{OK: false, Error: "db error"})
+		return
+	}
 	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		_ = json.NewEncoder(w).Encode(loginResp{OK: false, Error: "invalid credentials"})
 		return
 	}
+	logx.SetUser(ctx, id)
 	token, err := auth.GenerateToken(id, req.Email)
 	if err != nil {
-		log.Printf("login generate token error: %v", err)
+		slog.ErrorContext(ctx, "login generate token failed", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		_ = json.NewEncoder(w).Encode(loginResp{OK: false, Error: "token error"})
 		return
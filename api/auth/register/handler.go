@@ -3,13 +3,15 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/validate"
 )
 
 type registerReq struct {
@@ -24,7 +26,10 @@ type jsonResp struct {
 }
 
 func Handler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("register Handler invoked: method=%s path=%s", r.Method, r.URL.Path)
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		_ = json.NewEncoder(w).Encode(jsonResp{OK: false, Error: "method not allowed"})
@@ -37,26 +42,31 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
-	if req.Email == "" || len(req.Password) < 6 {
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(jsonResp{OK: false, Error: "invalid email or password"})
+	var invalid validate.Errors
+	invalid.String("email", req.Email, validate.Required, validate.MaxLength(254), validate.Email)
+	if invalid.String("password", req.Password, validate.Required, validate.MinLength(6)) && len(req.Password) > 72 {
+		// bcrypt only uses the first 72 bytes of a password.
+		invalid.Add("password", validate.CodeTooLong, "must be at most 72 bytes")
+	}
+	if invalid.Err() != nil {
+		httpx.Invalid(w, invalid)
 		return
 	}
-	ctx := context.Background()
+	ctx := context.WithoutCancel(r.Context())
 	pool, err := db.GetPool(ctx)
-    if err != nil {
-        log.Printf("register GetPool error: %v", err)
-        w.WriteHeader(http.StatusInternalServerError)
-        _ = json.NewEncoder(w).Encode(jsonResp{OK: false, Error: err.Error()})
-        return
-    }
+	if err != nil {
+		slog.ErrorContext(ctx, "register GetPool failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(jsonResp{OK: false, Error: "db error"})
+		return
+	}
 	var exists bool
-    if err = pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE email=$1)", req.Email).Scan(&exists); err != nil {
-        log.Printf("register query exists error: %v", err)
-        w.WriteHeader(http.StatusInternalServerError)
-        _ = json.NewEncoder(w).Encode(jsonResp{OK: false, Error: err.Error()})
-        return
-    }
+	if err = pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE email=$1)", req.Email).Scan(&exists); err != nil {
+		slog.ErrorContext(ctx, "register query exists failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(jsonResp{OK: false, Error: "db error"})
+		return
+	}
 	if exists {
 		w.WriteHeader(http.StatusConflict)
 		_ = json.NewEncoder(w).Encode(jsonResp{OK: false, Error: "email already registered"})
@@ -64,18 +74,18 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	}
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Printf("register bcrypt error: %v", err)
+		slog.ErrorContext(ctx, "register bcrypt failed", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		_ = json.NewEncoder(w).Encode(jsonResp{OK: false, Error: "hash error"})
 		return
 	}
 	var id int64
-    if err := pool.QueryRow(ctx, "INSERT INTO users(email, password_hash) VALUES($1,$2) RETURNING id", req.Email, string(hash)).Scan(&id); err != nil {
-        log.Printf("register insert error: %v", err)
-        w.WriteHeader(http.StatusInternalServerError)
-        _ = json.NewEncoder(w).Encode(jsonResp{OK: false, Error: err.Error()})
-        return
-    }
+	if err := pool.QueryRow(ctx, "INSERT INTO users(email, password_hash) VALUES($1,$2) RETURNING id", req.Email, string(hash)).Scan(&id); err != nil {
+		slog.ErrorContext(ctx, "register insert failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(jsonResp{OK: false, Error: "db error"})
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(jsonResp{OK: true, Data: map[string]interface{}{"id": id, "email": req.Email}})
 }
@@ -1,74 +1,135 @@
 package handler
 
 import (
-    "context"
-    "encoding/json"
-    "net/http"
-    "log"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
 
-    "chronos-task-manager/pkg/auth"
-    "chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/auth"
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/logx"
+	"chronos-task-manager/pkg/settings"
+	"chronos-task-manager/pkg/validate"
 )
 
 type daySummary struct {
-	Date      string `json:"date"`
-	HasTasks  bool   `json:"hasTasks"`
-	Pending   int    `json:"pending"`
-	Completed int    `json:"completed"`
+	Date            string `json:"date"`
+	HasTasks        bool   `json:"hasTasks"`
+	Pending         int    `json:"pending"`
+	Completed       int    `json:"completed"`
+	PlannedMinutes  int    `json:"plannedMinutes"`
+	CapacityMinutes int    `json:"capacityMinutes"`
+	Overbooked      bool   `json:"overbooked"`
+	// Deadlines counts the todos due that day, whatever day they are
+	// scheduled on; DeadlinesPending those not completed yet.
+	Deadlines        int `json:"deadlines"`
+	DeadlinesPending int `json:"deadlinesPending"`
 }
 
 func Handler(w http.ResponseWriter, r *http.Request) {
-    log.Printf("calendar Handler invoked: method=%s path=%s", r.Method, r.URL.Path)
-    if r.Method != http.MethodGet {
-        w.WriteHeader(http.StatusMethodNotAllowed)
-        json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "method not allowed"})
-        return
-    }
-    token, err := auth.FromAuthHeader(r.Header.Get("Authorization"))
-    if err != nil {
-        w.WriteHeader(http.StatusUnauthorized)
-        json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "unauthorized"})
-        return
-    }
-    c, err := auth.ParseToken(token)
-    if err != nil {
-        w.WriteHeader(http.StatusUnauthorized)
-        json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "unauthorized"})
-        return
-    }
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	httpx.Deprecate(w, r, "/api/v1/calendar")
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "method not allowed"})
+		return
+	}
+	token, err := auth.FromAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "unauthorized"})
+		return
+	}
+	c, err := auth.ParseToken(token)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "unauthorized"})
+		return
+	}
+	logx.SetUser(r.Context(), c.UserID)
 	month := r.URL.Query().Get("month")
-	ctx := context.Background()
-    pool, err := db.GetPool(ctx)
-    if err != nil {
-        w.WriteHeader(http.StatusInternalServerError)
-        json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": err.Error()})
-        return
-    }
+	var invalid validate.Errors
+	invalid.String("month", month, validate.Required, validate.Month)
+	// ?projectId= limits the summary to one project's todos.
+	var projectID int64
+	if v := r.URL.Query().Get("projectId"); v != "" {
+		if projectID, err = strconv.ParseInt(v, 10, 64); err != nil || projectID <= 0 {
+			invalid.Add("projectId", validate.CodeFormat, "must be a positive id")
+		}
+	}
+	if invalid.Err() != nil {
+		// On /api/v1/calendar/{yyyy-mm} the month is the resource, so a
+		// malformed one does not exist.
+		if httpx.V1(r) && invalid.Has("month") {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "not found"})
+			return
+		}
+		httpx.Invalid(w, invalid)
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "calendar GetPool failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
 	rows, err := pool.Query(ctx, `
-        SELECT to_char(date,'YYYY-MM-DD') as d,
-               SUM(CASE WHEN completed THEN 1 ELSE 0 END) AS completed,
-               SUM(CASE WHEN completed THEN 0 ELSE 1 END) AS pending
-        FROM todos
-        WHERE user_id=$1 AND to_char(date,'YYYY-MM')=$2
-        GROUP BY d
-    `, c.UserID, month)
-    if err != nil {
-        w.WriteHeader(http.StatusInternalServerError)
-        json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": err.Error()})
-        return
-    }
+        WITH t AS (
+            SELECT date, deadline, completed, estimate_minutes FROM todos
+            WHERE user_id=$1 AND deleted_at IS NULL AND ($3::bigint=0 OR project_id=$3)
+        )
+        SELECT d, SUM(completed), SUM(pending), COALESCE(SUM(planned),0), SUM(due), SUM(due_pending)
+        FROM (
+            SELECT to_char(date,'YYYY-MM-DD') AS d,
+                   CASE WHEN completed THEN 1 ELSE 0 END AS completed,
+                   CASE WHEN completed THEN 0 ELSE 1 END AS pending,
+                   estimate_minutes AS planned, 0 AS due, 0 AS due_pending
+            FROM t WHERE to_char(date,'YYYY-MM')=$2
+            UNION ALL
+            SELECT to_char(deadline,'YYYY-MM-DD'), 0, 0, NULL, 1, CASE WHEN completed THEN 0 ELSE 1 END
+            FROM t WHERE to_char(deadline,'YYYY-MM')=$2
+        ) x
+        GROUP BY d ORDER BY d
+    `, c.UserID, month, projectID)
+	if err != nil {
+		slog.ErrorContext(ctx, "calendar query failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
 	defer rows.Close()
+	s, err := settings.Load(ctx, pool, c.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
 	var res []daySummary
 	for rows.Next() {
 		var d daySummary
-        if err := rows.Scan(&d.Date, &d.Completed, &d.Pending); err != nil {
-            w.WriteHeader(http.StatusInternalServerError)
-            json.NewEncoder(w).Encode(map[string]any{"ok": false, "error": err.Error()})
-            return
-        }
+		if err := rows.Scan(&d.Date, &d.Completed, &d.Pending, &d.PlannedMinutes, &d.Deadlines, &d.DeadlinesPending); err != nil {
+			slog.ErrorContext(ctx, "calendar scan failed", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]any{"ok": false, "error": "db error"})
+			return
+		}
 		d.HasTasks = d.Completed+d.Pending > 0
+		if day, err := time.Parse("2006-01-02", d.Date); err == nil {
+			d.CapacityMinutes = s.CapacityOn(day)
+		}
+		d.Overbooked = d.PlannedMinutes > d.CapacityMinutes
 		res = append(res, d)
 	}
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": res})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": res})
 }
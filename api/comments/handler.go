@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/comments"
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/page"
+)
+
+type commentReq struct {
+	ID     interface{} `json:"id"`
+	TodoID interface{} `json:"todoId"`
+	Body   string      `json:"body"`
+}
+
+// Handler lists, adds, edits and deletes the comments of a todo. Comments of
+// a trashed todo are hidden until it is restored and go away with it when it
+// is deleted for good.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "comments GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		todoID, _ := strconv.ParseInt(r.URL.Query().Get("todoId"), 10, 64)
+		if todoID == 0 {
+			httpx.Error(w, http.StatusBadRequest, "missing todoId")
+			return
+		}
+		req, err := page.FromQuery(r.URL.Query(), 50, 200)
+		if err != nil {
+			httpx.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !ownsTodo(ctx, w, pool, c.UserID, todoID) {
+			return
+		}
+		list, info, err := comments.List(ctx, pool, todoID, req)
+		if err != nil {
+			slog.ErrorContext(ctx, "comments list failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.JSON(w, http.StatusOK, map[string]interface{}{"ok": true, "data": list, "page": info})
+	case http.MethodPost:
+		var body commentReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		text, err := comments.CleanBody(body.Body)
+		if err != nil {
+			httpx.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		todoID := httpx.ParseID(body.TodoID)
+		if !ownsTodo(ctx, w, pool, c.UserID, todoID) {
+			return
+		}
+		cm, err := comments.Create(ctx, pool, c.UserID, todoID, text)
+		if err != nil {
+			slog.ErrorContext(ctx, "comments insert failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, cm)
+	case http.MethodPut:
+		var body commentReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		text, err := comments.CleanBody(body.Body)
+		if err != nil {
+			httpx.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		cm, err := comments.Update(ctx, pool, c.UserID, httpx.ParseID(body.ID), text)
+		if errors.Is(err, pgx.ErrNoRows) {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "comments update failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, cm)
+	case http.MethodDelete:
+		id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		tag, err := pool.Exec(ctx, "DELETE FROM todo_comments WHERE id=$1 AND user_id=$2 AND todo_id IN (SELECT id FROM todos WHERE deleted_at IS NULL)", id, c.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "comments delete failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpx.OK(w, nil)
+	default:
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// ownsTodo reports whether todoID is a live todo of the user, writing the
+// error response when it is not.
+func ownsTodo(ctx context.Context, w http.ResponseWriter, q db.Querier, userID, todoID int64) bool {
+	var ok bool
+	if err := q.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM todos WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL)", todoID, userID).Scan(&ok); err != nil {
+		slog.ErrorContext(ctx, "comments todo lookup failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return false
+	}
+	if !ok {
+		httpx.Error(w, http.StatusNotFound, "todo not found")
+	}
+	return ok
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"chronos-task-manager/pkg/attachments"
+	"chronos-task-manager/pkg/blob"
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/trash"
+)
+
+// Handler is invoked by the Vercel cron defined in vercel.json. Vercel sends
+// CRON_SECRET as a bearer token, so anything else is rejected.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	secret := os.Getenv("CRON_SECRET")
+	if secret == "" || r.Header.Get("Authorization") != "Bearer "+secret {
+		httpx.Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "purge GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	cutoff := time.Now().Add(-trash.Retention())
+	store, err := blob.FromEnv()
+	if err != nil {
+		slog.ErrorContext(ctx, "purge store failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "storage not configured")
+		return
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "purge begin failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	todos, subtasks, keys, err := trash.Purge(ctx, tx, cutoff)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "purge failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	// Files go only once the rows are gone for good.
+	attachments.RemoveBlobs(ctx, store, keys)
+	files := len(keys)
+	slog.InfoContext(ctx, "purge done", "todos", todos, "subtasks", subtasks, "attachments", files, "cutoff", cutoff.Format(time.RFC3339))
+	httpx.OK(w, map[string]interface{}{"todos": todos, "subtasks": subtasks, "attachments": files})
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/rollover"
+	"chronos-task-manager/pkg/settings"
+)
+
+// Handler is invoked hourly by the Vercel cron defined in vercel.json and
+// rolls over every user whose local day has started since their last
+// rollover. Users are handled one transaction at a time so that one failure
+// does not hold back the rest.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	secret := os.Getenv("CRON_SECRET")
+	if secret == "" || r.Header.Get("Authorization") != "Bearer "+secret {
+		httpx.Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "rollover cron GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	rows, err := pool.Query(ctx, "SELECT user_id FROM user_settings WHERE rollover_mode<>$1", settings.RolloverOff)
+	if err != nil {
+		slog.ErrorContext(ctx, "rollover cron users failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	// A partial list would report success for users who were never run.
+	users, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		slog.ErrorContext(ctx, "rollover cron users failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	now := time.Now()
+	var ran, moved, copied, failed int
+	for _, userID := range users {
+		res, done, err := runUser(ctx, pool, userID, now)
+		if err != nil {
+			slog.ErrorContext(ctx, "rollover cron failed", "user_id", userID, "err", err)
+			failed++
+			continue
+		}
+		if done {
+			ran++
+			moved += len(res.Moved)
+			copied += len(res.Copied)
+		}
+	}
+	slog.InfoContext(ctx, "rollover cron done", "users", len(users), "ran", ran, "moved", moved, "copied", copied, "failed", failed)
+	httpx.OK(w, map[string]interface{}{"users": ran, "moved": moved, "copied": copied, "failed": failed})
+}
+
+// runUser rolls one user over if it is due. The settings row is locked first
+// so concurrent runs cannot roll the same day over twice.
+func runUser(ctx context.Context, pool *pgxpool.Pool, userID int64, now time.Time) (rollover.Result, bool, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return rollover.Result{}, false, err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "SELECT 1 FROM user_settings WHERE user_id=$1 FOR UPDATE", userID); err != nil {
+		return rollover.Result{}, false, err
+	}
+	s, err := settings.Load(ctx, tx, userID)
+	if err != nil {
+		return rollover.Result{}, false, err
+	}
+	today, due := rollover.Due(s, now)
+	if !due {
+		return rollover.Result{}, false, nil
+	}
+	res, err := rollover.Run(ctx, tx, userID, s.RolloverMode, today)
+	if err != nil {
+		return res, false, err
+	}
+	return res, true, tx.Commit(ctx)
+}
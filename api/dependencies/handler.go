@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/deps"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/todos"
+)
+
+type depReq struct {
+	TodoID    interface{} `json:"todoId"`
+	BlockedBy interface{} `json:"blockedBy"`
+}
+
+type node struct {
+	ID        int64   `json:"id"`
+	Title     string  `json:"title"`
+	Date      string  `json:"date"`
+	Completed bool    `json:"completed"`
+	Blocked   bool    `json:"blocked"`
+	BlockedBy []int64 `json:"blockedBy,omitempty"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "dependencies GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// The graph around ?ids=1,2,3 (everything they block or are blocked
+		// by, transitively), or the user's whole graph without ids.
+		edges, err := deps.Load(ctx, pool, c.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "dependencies load failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		var seeds []int64
+		for _, s := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			if id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+				seeds = append(seeds, id)
+			}
+		}
+		if len(seeds) == 0 {
+			for _, e := range edges {
+				seeds = append(seeds, e.TodoID)
+			}
+		}
+		ids, sub := deps.Component(edges, seeds)
+		list, err := todos.List(ctx, pool, "user_id=$1 AND id = ANY($2)", "ORDER BY date, id", c.UserID, ids)
+		if err != nil {
+			slog.ErrorContext(ctx, "dependencies list failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		nodes := make([]node, 0, len(list))
+		live := map[int64]bool{}
+		for _, t := range list {
+			live[t.ID] = true
+			nodes = append(nodes, node{ID: t.ID, Title: t.Title, Date: t.Date, Completed: t.Completed, Blocked: t.Blocked, BlockedBy: t.BlockedBy})
+		}
+		// Edges touching trashed todos are kept in the table but not shown.
+		shown := []deps.Edge{}
+		for _, e := range sub {
+			if live[e.TodoID] && live[e.BlockedBy] {
+				shown = append(shown, e)
+			}
+		}
+		httpx.OK(w, map[string]interface{}{"nodes": nodes, "edges": shown})
+	case http.MethodPost:
+		var body depReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		todoID, blockedBy := httpx.ParseID(body.TodoID), httpx.ParseID(body.BlockedBy)
+		if todoID == 0 || blockedBy == 0 {
+			httpx.Error(w, http.StatusBadRequest, "todoId and blockedBy are required")
+			return
+		}
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		defer tx.Rollback(ctx)
+		// Serialize edge inserts per user so two concurrent requests cannot
+		// each pass the cycle check and together close a cycle.
+		if err := db.LockUser(ctx, tx, db.LockDependencies, c.UserID); err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		var n int
+		if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM todos WHERE user_id=$1 AND id IN ($2,$3) AND deleted_at IS NULL", c.UserID, todoID, blockedBy).Scan(&n); err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if (todoID == blockedBy && n != 1) || (todoID != blockedBy && n != 2) {
+			httpx.Error(w, http.StatusNotFound, "todo not found")
+			return
+		}
+		edges, err := deps.Load(ctx, tx, c.UserID)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if cycle := deps.CyclePath(edges, todoID, blockedBy); cycle != nil {
+			httpx.JSON(w, http.StatusConflict, map[string]interface{}{"ok": false, "error": "dependency cycle", "cycle": cycle})
+			return
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO todo_dependencies(user_id,todo_id,blocked_by) VALUES($1,$2,$3) ON CONFLICT DO NOTHING", c.UserID, todoID, blockedBy); err != nil {
+			slog.ErrorContext(ctx, "dependencies insert failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, deps.Edge{TodoID: todoID, BlockedBy: blockedBy})
+	case http.MethodDelete:
+		q := r.URL.Query()
+		todoID, _ := strconv.ParseInt(q.Get("todoId"), 10, 64)
+		blockedBy, _ := strconv.ParseInt(q.Get("blockedBy"), 10, 64)
+		tag, err := pool.Exec(ctx, "DELETE FROM todo_dependencies WHERE user_id=$1 AND todo_id=$2 AND blocked_by=$3", c.UserID, todoID, blockedBy)
+		if err != nil {
+			slog.ErrorContext(ctx, "dependencies delete failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpx.OK(w, nil)
+	default:
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
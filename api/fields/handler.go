@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/fields"
+	"chronos-task-manager/pkg/httpx"
+)
+
+type fieldReq struct {
+	ID       interface{} `json:"id"`
+	GroupID  string      `json:"groupId"`
+	Key      string      `json:"key"`
+	Label    *string     `json:"label"`
+	Type     string      `json:"type"`
+	Options  []string    `json:"options"`
+	Required *bool       `json:"required"`
+	Position *int        `json:"position"`
+}
+
+// Handler manages custom field definitions. A field belongs to one group and
+// is identified in todo payloads by its key; group, key and type are fixed
+// once created.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "fields GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var list []fields.Field
+		if g := r.URL.Query().Get("groupId"); g != "" {
+			list, err = fields.ForGroup(ctx, pool, c.UserID, g)
+		} else {
+			list, err = fields.List(ctx, pool, c.UserID)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "fields list failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, list)
+	case http.MethodPost:
+		var body fieldReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		f := fields.Field{GroupID: body.GroupID, Key: body.Key, Type: body.Type, Options: body.Options}
+		if body.Label != nil {
+			f.Label = *body.Label
+		}
+		if body.Required != nil {
+			f.Required = *body.Required
+		}
+		if err := f.Validate(); err != nil {
+			httpx.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if f.Options == nil {
+			f.Options = []string{}
+		}
+		// New fields go last in their group unless a position is given.
+		var id int64
+		err := pool.QueryRow(ctx, `INSERT INTO custom_fields(user_id,group_id,key,label,type,options,required,position)
+            VALUES($1,$2,$3,$4,$5,$6,$7,COALESCE($8,(SELECT COUNT(*) FROM custom_fields WHERE user_id=$1 AND group_id=$2))) RETURNING id`,
+			c.UserID, f.GroupID, f.Key, f.Label, f.Type, f.Options, f.Required, body.Position).Scan(&id)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			httpx.Error(w, http.StatusConflict, "a field with this key already exists in the group")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "fields insert failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		respond(ctx, w, pool, c.UserID, id)
+	case http.MethodPut:
+		// Updates label, options, required and position. Values of a select
+		// field that are no longer among its options are removed from todos.
+		var body fieldReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		defer tx.Rollback(ctx)
+		f, err := fields.Get(ctx, tx, c.UserID, httpx.ParseID(body.ID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if body.Label != nil {
+			f.Label = *body.Label
+		}
+		if body.Options != nil {
+			f.Options = body.Options
+		}
+		if body.Required != nil {
+			f.Required = *body.Required
+		}
+		if body.Position != nil {
+			f.Position = *body.Position
+		}
+		if err := f.Validate(); err != nil {
+			httpx.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if f.Options == nil {
+			f.Options = []string{}
+		}
+		if _, err := tx.Exec(ctx, "UPDATE custom_fields SET label=$3, options=$4, required=$5, position=$6 WHERE user_id=$1 AND id=$2", c.UserID, f.ID, f.Label, f.Options, f.Required, f.Position); err != nil {
+			slog.ErrorContext(ctx, "fields update failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if f.Type == fields.Select {
+			if _, err := tx.Exec(ctx, "UPDATE todos SET custom_fields=custom_fields-$3 WHERE user_id=$1 AND group_id=$2 AND custom_fields ? $3 AND NOT (custom_fields->>$3 = ANY($4))", c.UserID, f.GroupID, f.Key, f.Options); err != nil {
+				slog.ErrorContext(ctx, "fields prune failed", "err", err)
+				httpx.Error(w, http.StatusInternalServerError, "db error")
+				return
+			}
+		}
+		if err := tx.Commit(ctx); err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		respond(ctx, w, pool, c.UserID, f.ID)
+	case http.MethodDelete:
+		// Deleting a field also removes its values from the group's todos.
+		id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		defer tx.Rollback(ctx)
+		var groupID, key string
+		err = tx.QueryRow(ctx, "DELETE FROM custom_fields WHERE user_id=$1 AND id=$2 RETURNING group_id, key", c.UserID, id).Scan(&groupID, &key)
+		if errors.Is(err, pgx.ErrNoRows) {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "fields delete failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		_, err = tx.Exec(ctx, "UPDATE todos SET custom_fields=custom_fields-$3 WHERE user_id=$1 AND group_id=$2 AND custom_fields ? $3", c.UserID, groupID, key)
+		if err == nil {
+			err = tx.Commit(ctx)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "fields delete values failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, nil)
+	default:
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func respond(ctx context.Context, w http.ResponseWriter, q db.Querier, userID, id int64) {
+	f, err := fields.Get(ctx, q, userID, id)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	httpx.OK(w, f)
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/history"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/page"
+)
+
+// Handler returns the change timeline of one todo and its subtasks.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	todoID, _ := strconv.ParseInt(r.URL.Query().Get("todoId"), 10, 64)
+	if todoID == 0 {
+		httpx.Error(w, http.StatusBadRequest, "missing todoId")
+		return
+	}
+	req, err := page.FromQuery(r.URL.Query(), 50, 200)
+	if err != nil {
+		httpx.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "history GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	entries, info, err := history.Timeline(ctx, pool, c.UserID, todoID, req)
+	if err != nil {
+		slog.ErrorContext(ctx, "history timeline failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	httpx.JSON(w, http.StatusOK, map[string]interface{}{"ok": true, "data": entries, "page": info})
+}
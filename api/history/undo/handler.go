@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/history"
+	"chronos-task-manager/pkg/httpx"
+)
+
+type undoReq struct {
+	Steps  int         `json:"steps"`
+	TodoID interface{} `json:"todoId"`
+}
+
+// maxSteps bounds how many changes a single request may revert.
+const maxSteps = 50
+
+// Handler reverts the caller's most recent changes. The body is optional:
+// {"steps": n} undoes the last n changes, {"todoId": id} limits undo to one todo.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	var body undoReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		httpx.Error(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if body.Steps > maxSteps {
+		body.Steps = maxSteps
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "undo GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	undone, err := history.Undo(ctx, tx, c.UserID, c.UserID, body.Steps, httpx.ParseID(body.TodoID))
+	if errors.Is(err, history.ErrNothingToUndo) {
+		httpx.Error(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "undo failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	httpx.OK(w, undone)
+}
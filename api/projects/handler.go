@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/projects"
+	"chronos-task-manager/pkg/validate"
+)
+
+type projectReq struct {
+	ID          interface{} `json:"id"`
+	Name        *string     `json:"name"`
+	Description *string     `json:"description"`
+	Status      *string     `json:"status"`
+	TargetDate  *string     `json:"targetDate"`
+	Archived    *bool       `json:"archived"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "projects GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		if idStr := q.Get("id"); idStr != "" {
+			id, _ := strconv.ParseInt(idStr, 10, 64)
+			list, err := projects.List(ctx, pool, "p.id=$2", c.UserID, id)
+			if err != nil {
+				slog.ErrorContext(ctx, "projects get failed", "err", err)
+				httpx.Error(w, http.StatusInternalServerError, "db error")
+				return
+			}
+			if len(list) == 0 {
+				httpx.Error(w, http.StatusNotFound, "not found")
+				return
+			}
+			httpx.OK(w, list[0])
+			return
+		}
+		// Archived projects are hidden unless asked for with ?archived=1
+		// (only archived) or ?archived=all.
+		where := "p.archived_at IS NULL"
+		switch q.Get("archived") {
+		case "1", "true":
+			where = "p.archived_at IS NOT NULL"
+		case "all":
+			where = "TRUE"
+		}
+		list, err := projects.List(ctx, pool, where, c.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "projects list failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, list)
+	case http.MethodPost:
+		var body projectReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if body.Name == nil || strings.TrimSpace(*body.Name) == "" {
+			httpx.Error(w, http.StatusBadRequest, "name is required")
+			return
+		}
+		status := projects.StatusActive
+		if body.Status != nil {
+			status = *body.Status
+		}
+		if !projects.ValidStatus(status) {
+			httpx.Error(w, http.StatusBadRequest, "status must be active, on_hold or completed")
+			return
+		}
+		var invalid validate.Errors
+		if err := projects.Check(body.Name, body.Description, body.TargetDate); errors.As(err, &invalid) {
+			httpx.Invalid(w, invalid)
+			return
+		}
+		var id int64
+		err := pool.QueryRow(ctx, "INSERT INTO projects(user_id,name,description,status,target_date) VALUES($1,$2,$3,$4,NULLIF($5,'')::date) RETURNING id",
+			c.UserID, strings.TrimSpace(*body.Name), deref(body.Description), status, deref(body.TargetDate)).Scan(&id)
+		if err != nil {
+			slog.ErrorContext(ctx, "projects insert failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		list, err := projects.List(ctx, pool, "p.id=$2", c.UserID, id)
+		if err != nil || len(list) == 0 {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, list[0])
+	case http.MethodPut:
+		var body projectReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		id := httpx.ParseID(body.ID)
+		if id == 0 {
+			httpx.Error(w, http.StatusBadRequest, "missing id")
+			return
+		}
+		if body.Status != nil && !projects.ValidStatus(*body.Status) {
+			httpx.Error(w, http.StatusBadRequest, "status must be active, on_hold or completed")
+			return
+		}
+		if body.Name != nil && strings.TrimSpace(*body.Name) == "" {
+			httpx.Error(w, http.StatusBadRequest, "name cannot be empty")
+			return
+		}
+		var invalid validate.Errors
+		if err := projects.Check(body.Name, body.Description, body.TargetDate); errors.As(err, &invalid) {
+			httpx.Invalid(w, invalid)
+			return
+		}
+		// An empty targetDate clears it; an absent one keeps it.
+		tag, err := pool.Exec(ctx, `UPDATE projects SET
+                name=COALESCE($3,name),
+                description=COALESCE($4,description),
+                status=COALESCE($5,status),
+                target_date=CASE WHEN $6::text IS NULL THEN target_date ELSE NULLIF($6,'')::date END,
+                updated_at=NOW()
+            WHERE user_id=$1 AND id=$2`,
+			c.UserID, id, trimmed(body.Name), body.Description, body.Status, body.TargetDate)
+		if err != nil {
+			slog.ErrorContext(ctx, "projects update failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		list, err := projects.List(ctx, pool, "p.id=$2", c.UserID, id)
+		if err != nil || len(list) == 0 {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, list[0])
+	case http.MethodPatch:
+		// Archive or unarchive: {id, archived}.
+		var body projectReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		id := httpx.ParseID(body.ID)
+		if id == 0 || body.Archived == nil {
+			httpx.Error(w, http.StatusBadRequest, "id and archived are required")
+			return
+		}
+		tag, err := pool.Exec(ctx, "UPDATE projects SET archived_at=CASE WHEN $3 THEN COALESCE(archived_at, NOW()) ELSE NULL END, updated_at=NOW() WHERE user_id=$1 AND id=$2", c.UserID, id, *body.Archived)
+		if err != nil {
+			slog.ErrorContext(ctx, "projects archive failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpx.OK(w, nil)
+	case http.MethodDelete:
+		// Todos of a deleted project are kept and simply lose their project.
+		id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		tag, err := pool.Exec(ctx, "DELETE FROM projects WHERE user_id=$1 AND id=$2", c.UserID, id)
+		if err != nil {
+			slog.ErrorContext(ctx, "projects delete failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpx.OK(w, nil)
+	default:
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func trimmed(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*s)
+	return &t
+}
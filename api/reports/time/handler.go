@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+	_ "time/tzdata" // the serverless runtime has no zoneinfo
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/timetrack"
+)
+
+// maxDays bounds the range of one report.
+const maxDays = 366
+
+// Handler sums tracked time over ?from=YYYY-MM-DD&to=YYYY-MM-DD (inclusive)
+// by day, group or project. Days follow ?tz= (an IANA zone, default UTC), and
+// ?format=csv returns the rows as a CSV download.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	loc := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			httpx.Error(w, http.StatusBadRequest, "unknown tz")
+			return
+		}
+		loc = l
+	}
+	from, err1 := time.ParseInLocation("2006-01-02", q.Get("from"), loc)
+	last, err2 := time.ParseInLocation("2006-01-02", q.Get("to"), loc)
+	if err1 != nil || err2 != nil || last.Before(from) {
+		httpx.Error(w, http.StatusBadRequest, "from and to must be YYYY-MM-DD with from <= to")
+		return
+	}
+	to := last.AddDate(0, 0, 1)
+	if to.Sub(from) > maxDays*24*time.Hour {
+		httpx.Error(w, http.StatusBadRequest, fmt.Sprintf("range must be at most %d days", maxDays))
+		return
+	}
+	by := q.Get("by")
+	if by == "" {
+		by = timetrack.ByDay
+	}
+
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "reports GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	spans, err := timetrack.LoadSpans(ctx, pool, c.UserID, from, to)
+	if err != nil {
+		slog.ErrorContext(ctx, "reports load failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	rows, err := timetrack.Summarize(spans, by, from, to, time.Now())
+	if err != nil {
+		httpx.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if q.Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="time-%s-%s-%s.csv"`, by, q.Get("from"), q.Get("to")))
+		if err := timetrack.WriteCSV(w, rows); err != nil {
+			slog.ErrorContext(ctx, "reports csv failed", "err", err)
+		}
+		return
+	}
+	var total int64
+	for _, row := range rows {
+		total += row.Seconds
+	}
+	httpx.OK(w, map[string]interface{}{"by": by, "from": q.Get("from"), "to": q.Get("to"), "rows": rows, "totalSeconds": total})
+}
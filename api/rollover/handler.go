@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/rollover"
+	"chronos-task-manager/pkg/settings"
+)
+
+type rolloverReq struct {
+	Mode string `json:"mode"`
+}
+
+// Handler rolls the user's unfinished todos of past days over to today right
+// away. The mode defaults to the user's setting, or move when rollover is
+// off.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	var body rolloverReq
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "rollover GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	s, err := settings.Load(ctx, tx, c.UserID)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	mode := body.Mode
+	if mode == "" {
+		mode = s.RolloverMode
+	}
+	if mode == settings.RolloverOff {
+		mode = settings.RolloverMove
+	}
+	if mode != settings.RolloverMove && mode != settings.RolloverCopy {
+		httpx.Error(w, http.StatusBadRequest, "mode must be move or copy")
+		return
+	}
+	res, err := rollover.Run(ctx, tx, c.UserID, mode, rollover.Today(s.Location(), time.Now()))
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "rollover failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	httpx.OK(w, res)
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/settings"
+)
+
+type settingsReq struct {
+	DailyCapacityMinutes *int           `json:"dailyCapacityMinutes"`
+	WeekdayCapacity      map[string]int `json:"weekdayCapacity"`
+	Timezone             *string        `json:"timezone"`
+	RolloverMode         *string        `json:"rolloverMode"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "settings GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s, err := settings.Load(ctx, pool, c.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "settings load failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, s)
+	case http.MethodPut:
+		// Fields left out keep their value; weekdayCapacity replaces all
+		// overrides when present.
+		var body settingsReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		s, err := settings.Load(ctx, pool, c.UserID)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if body.DailyCapacityMinutes != nil {
+			s.DailyCapacityMinutes = *body.DailyCapacityMinutes
+		}
+		if body.WeekdayCapacity != nil {
+			s.WeekdayCapacity = body.WeekdayCapacity
+		}
+		if body.Timezone != nil {
+			s.Timezone = *body.Timezone
+		}
+		if body.RolloverMode != nil {
+			s.RolloverMode = *body.RolloverMode
+		}
+		if err := s.Validate(); err != nil {
+			httpx.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := settings.Save(ctx, pool, c.UserID, s); err != nil {
+			slog.ErrorContext(ctx, "settings save failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, s)
+	default:
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,361 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/history"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/todos"
+)
+
+// actionReq is the body of every action. id is the subtask acted on, or the
+// todo for demote; todoId is the todo the result goes to.
+type actionReq struct {
+	Action   string          `json:"action"`
+	ID       interface{}     `json:"id"`
+	TodoID   interface{}     `json:"todoId"`
+	ParentID json.RawMessage `json:"parentId"`
+	Position *int            `json:"position"`
+	Date     string          `json:"date"`
+}
+
+// failure is a client error raised by an action.
+type failure struct {
+	status int
+	msg    string
+}
+
+func (f *failure) Error() string { return f.msg }
+
+// Handler moves a subtask to another todo, promotes a subtask into a todo of
+// its own, demotes a todo into a subtask of another, or duplicates a
+// subtask. Subtasks change todo by being copied to the target with their
+// branch while the originals go to the trash, so every step shows up in the
+// history of both todos and can be undone.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	var body actionReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.Error(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if body.Position != nil && *body.Position < 0 {
+		*body.Position = 0
+	}
+	var run func(context.Context, pgx.Tx, int64, actionReq) (interface{}, error)
+	switch body.Action {
+	case "move":
+		run = move
+	case "promote":
+		run = promote
+	case "demote":
+		run = demote
+	case "duplicate":
+		run = duplicate
+	default:
+		httpx.Error(w, http.StatusBadRequest, "action must be move, promote, demote or duplicate")
+		return
+	}
+	if httpx.ParseID(body.ID) == 0 {
+		httpx.Error(w, http.StatusBadRequest, "missing id")
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "subtask actions GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	data, err := run(ctx, tx, c.UserID, body)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	var f *failure
+	if errors.As(err, &f) {
+		httpx.Error(w, f.status, f.msg)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "subtask action failed", "action", body.Action, "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	httpx.OK(w, data)
+}
+
+// move copies the subtask's branch into another todo and trashes it.
+func move(ctx context.Context, tx pgx.Tx, userID int64, body actionReq) (interface{}, error) {
+	sid := httpx.ParseID(body.ID)
+	srcTodo, err := lockSubtask(ctx, tx, userID, sid)
+	if err != nil {
+		return nil, err
+	}
+	target := httpx.ParseID(body.TodoID)
+	if target == 0 {
+		return nil, &failure{http.StatusBadRequest, "missing todoId"}
+	}
+	if target == srcTodo {
+		return nil, &failure{http.StatusBadRequest, "already in this todo; use PUT /api/subtasks with parentId to move it within the todo"}
+	}
+	parent, _, err := targetParent(ctx, tx, userID, target, body.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	node, err := loadBranch(ctx, tx, srcTodo, sid)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertCopy(ctx, tx, userID, target, parent, body.Position, &node); err != nil {
+		return nil, err
+	}
+	if err := trashSubtask(ctx, tx, userID, sid); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// duplicate copies the subtask's branch, reopened, right after the original
+// or to the given todo and parent.
+func duplicate(ctx context.Context, tx pgx.Tx, userID int64, body actionReq) (interface{}, error) {
+	sid := httpx.ParseID(body.ID)
+	srcTodo, err := lockSubtask(ctx, tx, userID, sid)
+	if err != nil {
+		return nil, err
+	}
+	node, err := loadBranch(ctx, tx, srcTodo, sid)
+	if err != nil {
+		return nil, err
+	}
+	target := srcTodo
+	if id := httpx.ParseID(body.TodoID); id != 0 {
+		target = id
+	}
+	parent, set, err := targetParent(ctx, tx, userID, target, body.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	position := body.Position
+	if !set && target == srcTodo {
+		parent = node.ParentID
+		if position == nil {
+			next := node.Position + 1
+			position = &next
+		}
+	}
+	nodes := []todos.Subtask{node}
+	todos.Reopen(nodes)
+	node = nodes[0]
+	if err := insertCopy(ctx, tx, userID, target, parent, position, &node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// promote turns the subtask into a todo on the same day (or date) in the
+// same group and project, with the subtask's children as its checklist.
+// promotedFrom links the new todo back to the one it came from.
+func promote(ctx context.Context, tx pgx.Tx, userID int64, body actionReq) (interface{}, error) {
+	sid := httpx.ParseID(body.ID)
+	srcTodo, err := lockSubtask(ctx, tx, userID, sid)
+	if err != nil {
+		return nil, err
+	}
+	src, err := todos.Get(ctx, tx, userID, srcTodo)
+	if err != nil {
+		return nil, err
+	}
+	node := todos.Find(src.Subtasks, sid)
+	if node == nil {
+		return nil, &failure{http.StatusNotFound, "not found"}
+	}
+	date := src.Date
+	if body.Date != "" {
+		if _, err := time.Parse("2006-01-02", body.Date); err != nil {
+			return nil, &failure{http.StatusBadRequest, "date must be YYYY-MM-DD"}
+		}
+		date = body.Date
+	}
+	t := todos.Todo{Title: node.Title, Date: date, GroupID: src.GroupID, ProjectID: src.ProjectID, PromotedFrom: &src.ID, Subtasks: node.Children}
+	if err := todos.Insert(ctx, tx, userID, &t); err != nil {
+		return nil, err
+	}
+	if node.Completed {
+		if _, err := tx.Exec(ctx, "UPDATE todos SET completed=true, completed_at=$2 WHERE id=$1", t.ID, node.CompletedAt); err != nil {
+			return nil, err
+		}
+	}
+	after, err := history.SnapshotTodo(ctx, tx, userID, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := history.Record(ctx, tx, userID, history.Entry{TodoID: t.ID, Entity: history.EntityTodo, Action: history.ActionCreate, After: after, ActorID: userID}); err != nil {
+		return nil, err
+	}
+	if err := trashSubtask(ctx, tx, userID, sid); err != nil {
+		return nil, err
+	}
+	return todos.Get(ctx, tx, userID, t.ID)
+}
+
+// demote turns the todo into a subtask of another todo, its checklist
+// becoming the new subtask's children, and moves the todo to the trash.
+// Fields a subtask does not have (description, dates, tags, ...) stay with
+// the trashed todo.
+func demote(ctx context.Context, tx pgx.Tx, userID int64, body actionReq) (interface{}, error) {
+	id := httpx.ParseID(body.ID)
+	target := httpx.ParseID(body.TodoID)
+	if target == 0 {
+		return nil, &failure{http.StatusBadRequest, "missing todoId"}
+	}
+	if target == id {
+		return nil, &failure{http.StatusBadRequest, "cannot demote a todo into itself"}
+	}
+	var locked int64
+	err := tx.QueryRow(ctx, "SELECT id FROM todos WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL FOR UPDATE", id, userID).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &failure{http.StatusNotFound, "not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	parent, _, err := targetParent(ctx, tx, userID, target, body.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	t, err := todos.Get(ctx, tx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	node := todos.Subtask{Title: t.Title, Completed: t.Completed, CompletedAt: t.CompletedAt, Children: t.Subtasks}
+	if err := insertCopy(ctx, tx, userID, target, parent, body.Position, &node); err != nil {
+		return nil, err
+	}
+	before, err := history.SnapshotTodo(ctx, tx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, "UPDATE todos SET deleted_at=NOW() WHERE id=$1", id); err != nil {
+		return nil, err
+	}
+	after, err := history.SnapshotTodo(ctx, tx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := history.Record(ctx, tx, userID, history.Entry{TodoID: id, Entity: history.EntityTodo, Action: history.ActionDelete, Before: before, After: after, ActorID: userID}); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// lockSubtask locks a live subtask of the user's live todo and returns the
+// todo's id.
+func lockSubtask(ctx context.Context, tx pgx.Tx, userID, sid int64) (int64, error) {
+	var todoID int64
+	err := tx.QueryRow(ctx, "SELECT s.todo_id FROM subtasks s JOIN todos t ON t.id=s.todo_id WHERE s.id=$1 AND t.user_id=$2 AND s.deleted_at IS NULL AND t.deleted_at IS NULL FOR UPDATE OF s", sid, userID).Scan(&todoID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, &failure{http.StatusNotFound, "not found"}
+	}
+	return todoID, err
+}
+
+// targetParent checks that the target todo is the user's and live and that
+// parentId, when given and not null, is a live subtask of it. set reports
+// whether parentId was in the body at all.
+func targetParent(ctx context.Context, tx pgx.Tx, userID, todoID int64, raw json.RawMessage) (parent *int64, set bool, err error) {
+	var owned bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM todos WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL)", todoID, userID).Scan(&owned); err != nil {
+		return nil, false, err
+	}
+	if !owned {
+		return nil, false, &failure{http.StatusNotFound, "target todo not found"}
+	}
+	if len(raw) == 0 {
+		return nil, false, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil || v == nil {
+		return nil, true, nil
+	}
+	pid := httpx.ParseID(v)
+	var ok bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM subtasks WHERE id=$1 AND todo_id=$2 AND deleted_at IS NULL)", pid, todoID).Scan(&ok); err != nil {
+		return nil, true, err
+	}
+	if !ok {
+		return nil, true, &failure{http.StatusBadRequest, "parent subtask not found"}
+	}
+	return &pid, true, nil
+}
+
+// loadBranch returns the live subtask sid of todoID with its branch.
+func loadBranch(ctx context.Context, tx pgx.Tx, todoID, sid int64) (todos.Subtask, error) {
+	flat, err := todos.Flat(ctx, tx, todoID)
+	if err != nil {
+		return todos.Subtask{}, err
+	}
+	node := todos.Find(todos.BuildTree(flat), sid)
+	if node == nil {
+		return todos.Subtask{}, fmt.Errorf("subtask %d missing from its tree", sid)
+	}
+	return *node, nil
+}
+
+// insertCopy inserts node with its branch into todoID and records the
+// creation; node gets the new ids.
+func insertCopy(ctx context.Context, tx pgx.Tx, userID, todoID int64, parent *int64, position *int, node *todos.Subtask) error {
+	pos, err := todos.Place(ctx, tx, todoID, parent, position, 0)
+	if err != nil {
+		return err
+	}
+	if err := todos.InsertBranch(ctx, tx, todoID, parent, pos, node); err != nil {
+		return err
+	}
+	after, _, err := history.SnapshotSubtask(ctx, tx, userID, node.ID)
+	if err != nil {
+		return err
+	}
+	return history.Record(ctx, tx, userID, history.Entry{TodoID: todoID, SubtaskID: &node.ID, Entity: history.EntitySubtask, Action: history.ActionCreate, After: after, ActorID: userID})
+}
+
+// trashSubtask moves the subtask's branch to the trash and records it.
+func trashSubtask(ctx context.Context, tx pgx.Tx, userID, sid int64) error {
+	before, todoID, err := history.SnapshotSubtask(ctx, tx, userID, sid)
+	if err != nil {
+		return err
+	}
+	if _, err := todos.TrashSubtask(ctx, tx, sid, time.Now()); err != nil {
+		return err
+	}
+	after, _, err := history.SnapshotSubtask(ctx, tx, userID, sid)
+	if err != nil {
+		return err
+	}
+	return history.Record(ctx, tx, userID, history.Entry{TodoID: todoID, SubtaskID: &sid, Entity: history.EntitySubtask, Action: history.ActionDelete, Before: before, After: after, ActorID: userID})
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/history"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/todos"
+	"chronos-task-manager/pkg/validate"
+)
+
+// Handler replaces a todo's whole checklist: PUT { todoId, subtasks } with
+// subtasks as { title, completed?, children? } trees. The current subtasks
+// go to the trash and the new ones are created in the order given; both are
+// recorded in the todo's history.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		TodoID   interface{}     `json:"todoId"`
+		Subtasks []todos.Subtask `json:"subtasks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.Error(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	todoID := httpx.ParseID(body.TodoID)
+	if todoID == 0 {
+		httpx.Error(w, http.StatusBadRequest, "missing todoId")
+		return
+	}
+	var invalid validate.Errors
+	if errors.As(todos.ValidateSubtasks(body.Subtasks), &invalid) {
+		httpx.Invalid(w, invalid)
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "checklist GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	var locked int64
+	err = tx.QueryRow(ctx, "SELECT id FROM todos WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL FOR UPDATE", todoID, c.UserID).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		httpx.Error(w, http.StatusNotFound, "not found")
+		return
+	}
+	if err == nil {
+		err = replace(ctx, tx, c.UserID, todoID, body.Subtasks)
+	}
+	var t *todos.Todo
+	if err == nil {
+		t, err = todos.Get(ctx, tx, c.UserID, todoID)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "checklist replace failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	httpx.OK(w, t)
+}
+
+// replace trashes the todo's top-level subtasks with their branches and
+// inserts nodes in their place.
+func replace(ctx context.Context, tx pgx.Tx, userID, todoID int64, nodes []todos.Subtask) error {
+	flat, err := todos.Flat(ctx, tx, todoID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, st := range flat {
+		if st.ParentID != nil {
+			continue
+		}
+		sid := st.ID
+		before, _, err := history.SnapshotSubtask(ctx, tx, userID, sid)
+		if err != nil {
+			return err
+		}
+		if _, err := todos.TrashSubtask(ctx, tx, sid, now); err != nil {
+			return err
+		}
+		if err := record(ctx, tx, userID, todoID, sid, history.ActionDelete, before); err != nil {
+			return err
+		}
+	}
+	if err := todos.InsertSubtasks(ctx, tx, todoID, nil, nodes); err != nil {
+		return err
+	}
+	for _, st := range nodes {
+		if err := record(ctx, tx, userID, todoID, st.ID, history.ActionCreate, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func record(ctx context.Context, tx pgx.Tx, userID, todoID, sid int64, action string, before json.RawMessage) error {
+	after, _, err := history.SnapshotSubtask(ctx, tx, userID, sid)
+	if err != nil {
+		return err
+	}
+	return history.Record(ctx, tx, userID, history.Entry{TodoID: todoID, SubtaskID: &sid, Entity: history.EntitySubtask, Action: action, Before: before, After: after, ActorID: userID})
+}
@@ -3,14 +3,46 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"chronos-task-manager/pkg/auth"
 	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/etag"
+	"chronos-task-manager/pkg/history"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/logx"
+	"chronos-task-manager/pkg/patch"
+	"chronos-task-manager/pkg/todos"
+	"chronos-task-manager/pkg/validate"
 )
 
+// completion is the PATCH response: the state after the request was applied.
+// Changed lists the other subtasks of the tree whose state followed along.
+type completion struct {
+	ID          int64        `json:"id"`
+	Completed   bool         `json:"completed"`
+	CompletedAt *time.Time   `json:"completedAt"`
+	Version     int64        `json:"version"`
+	Changed     []completion `json:"changed,omitempty"`
+}
+
+// Handler manages subtasks. The /api/v1/todos/{id}/subtasks routes arrive
+// here with the todo in ?todoId= and the subtask in ?id=; a subtask outside
+// that todo is then not found.
 func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	httpx.Deprecate(w, r, "/api/v1/todos")
 	token, err := auth.FromAuthHeader(r.Header.Get("Authorization"))
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -23,74 +55,156 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "unauthorized"})
 		return
 	}
-	ctx := context.Background()
+	logx.SetUser(r.Context(), c.UserID)
+	ctx := context.WithoutCancel(r.Context())
 	pool, err := db.GetPool(ctx)
 	if err != nil {
+		slog.ErrorContext(ctx, "subtasks GetPool failed", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": err.Error()})
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
 		return
 	}
 
 	switch r.Method {
+	case http.MethodGet:
+		// Lists a todo's subtask tree, or one subtask with its children.
+		tid := httpx.QueryID(r, "todoId")
+		t, err := todos.Get(ctx, pool, c.UserID, tid)
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "todo not found"})
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		if t.Subtasks == nil {
+			t.Subtasks = []todos.Subtask{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("id") == "" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": t.Subtasks})
+			return
+		}
+		st := todos.Find(t.Subtasks, httpx.QueryID(r, "id"))
+		if st == nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "not found"})
+			return
+		}
+		w.Header().Set("ETag", etag.Format(etag.Subtask, st.ID, st.Version))
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": st})
 	case http.MethodPut:
-		var body map[string]interface{}
-		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		// The body is a merge patch plus the subtask id. parentId moves the
+		// subtask with its branch under another subtask of the same todo
+		// (null moves it to the top level); position places it among its new
+		// siblings.
+		var doc map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid json"})
 			return
 		}
-		var sid int64
-		switch v := body["id"].(type) {
-		case float64:
-			sid = int64(v)
-		case string:
-			if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
-				sid = parsed
-			}
+		var rawID interface{}
+		json.Unmarshal(doc["id"], &rawID)
+		delete(doc, "id")
+		sid := httpx.QueryID(r, "id")
+		if sid == 0 {
+			sid = httpx.ParseID(rawID)
 		}
 		if sid == 0 {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "missing id"})
 			return
 		}
-		title, _ := body["title"].(string)
-		_, err := pool.Exec(ctx, "UPDATE subtasks SET title=COALESCE(NULLIF($1,''), title) WHERE id=$2 AND todo_id IN (SELECT id FROM todos WHERE user_id=$3)", title, sid, c.UserID)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": err.Error()})
+		update(ctx, w, r, pool, c.UserID, sid, patch.Body{Doc: doc})
+	case http.MethodPatch:
+		// A merge patch or JSON Patch body updates the subtask given by ?id=
+		// like PUT does.
+		if body, ok, err := patch.ReadBody(r); ok {
+			sid, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+			if sid == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "missing id"})
+				return
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid json"})
+				return
+			}
+			update(ctx, w, r, pool, c.UserID, sid, body)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
-	case http.MethodPatch:
+		// Otherwise it sets the completion state to the given value; repeating the same
+		// request is a no-op rather than flipping it back.
 		var body map[string]interface{}
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid json"})
 			return
 		}
-		var sid int64
-		switch v := body["id"].(type) {
-		case float64:
-			sid = int64(v)
-		case string:
-			if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
-				sid = parsed
-			}
-		}
+		sid := httpx.QueryID(r, "id")
 		if sid == 0 {
+			sid = httpx.ParseID(body["id"])
+		}
+		want, ok := body["completed"].(bool)
+		completeParent, _ := body["completeParent"].(bool)
+		if sid == 0 || !ok {
 			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "missing id"})
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "id and completed are required"})
+			return
+		}
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
 			return
 		}
-		_, err := pool.Exec(ctx, "UPDATE subtasks SET completed = NOT completed WHERE id=$1 AND todo_id IN (SELECT id FROM todos WHERE user_id=$2)", sid, c.UserID)
+		defer tx.Rollback(ctx)
+		if !precondition(ctx, tx, w, r, c.UserID, sid) {
+			return
+		}
+		// Completion follows the tree: the branch below is completed too,
+		// reopening reopens the ancestors, and with completeParent a parent
+		// whose children are now all done is completed as well.
+		state := completion{ID: sid}
+		var todoID int64
+		err = tx.QueryRow(ctx, "SELECT todo_id,completed,completed_at,version FROM subtasks WHERE id=$1", sid).Scan(&todoID, &state.Completed, &state.CompletedAt, &state.Version)
+		var flat []todos.Subtask
+		if err == nil {
+			flat, err = todos.Flat(ctx, tx, todoID)
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": err.Error()})
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		changes := todos.CompletionChanges(flat, sid, want, completeParent)
+		for _, id := range todos.SortedIDs(changes) {
+			st, err := setCompleted(ctx, tx, c.UserID, id, changes[id])
+			if err != nil {
+				slog.ErrorContext(ctx, "subtasks complete failed", "err", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+				return
+			}
+			if id == sid {
+				state = st
+			} else {
+				state.Changed = append(state.Changed, st)
+			}
+		}
+		if err := tx.Commit(ctx); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
 			return
 		}
+		w.Header().Set("ETag", etag.Format(etag.Subtask, sid, state.Version))
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": state})
 	case http.MethodPost:
 		var body map[string]interface{}
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
@@ -98,14 +212,9 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid json"})
 			return
 		}
-		var tid int64
-		switch v := body["todoId"].(type) {
-		case float64:
-			tid = int64(v)
-		case string:
-			if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
-				tid = parsed
-			}
+		tid := httpx.QueryID(r, "todoId")
+		if tid == 0 {
+			tid = httpx.ParseID(body["todoId"])
 		}
 		if tid == 0 {
 			w.WriteHeader(http.StatusBadRequest)
@@ -113,39 +222,132 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		title, _ := body["title"].(string)
-		var sid int64
-		if err := pool.QueryRow(ctx, "INSERT INTO subtasks(todo_id,title,completed) VALUES($1,$2,false) RETURNING id", tid, title).Scan(&sid); err != nil {
+		var invalid validate.Errors
+		if err := todos.ValidateSubtaskTitle(&title); errors.As(err, &invalid) {
+			httpx.Invalid(w, invalid)
+			return
+		}
+		var parent *int64
+		if pid := httpx.ParseID(body["parentId"]); pid != 0 {
+			parent = &pid
+		}
+		tx, err := pool.Begin(ctx)
+		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": err.Error()})
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": map[string]interface{}{"id": sid, "title": title, "completed": false}})
-	case http.MethodDelete:
-		var body map[string]interface{}
-		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid json"})
+		defer tx.Rollback(ctx)
+		var owned bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM todos WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL)", tid, c.UserID).Scan(&owned); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		if !owned {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "todo not found"})
 			return
 		}
-		var sid int64
-		switch v := body["id"].(type) {
-		case float64:
-			sid = int64(v)
-		case string:
-			if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
-				sid = parsed
+		if parent != nil {
+			var ok bool
+			if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM subtasks WHERE id=$1 AND todo_id=$2 AND deleted_at IS NULL)", *parent, tid).Scan(&ok); err != nil {
+				slog.ErrorContext(ctx, "subtasks parent failed", "err", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+				return
 			}
+			if !ok {
+				httpx.InvalidField(w, "parentId", validate.CodeUnknownValue, "parent subtask not found")
+				return
+			}
+		}
+		pos, err := todos.Place(ctx, tx, tid, parent, parsePosition(body["position"]), 0)
+		var sid, version int64
+		if err == nil {
+			err = tx.QueryRow(ctx, "INSERT INTO subtasks(todo_id,parent_id,position,title,completed) VALUES($1,$2,$3,$4,false) RETURNING id, version", tid, parent, pos, title).Scan(&sid, &version)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "subtasks create failed", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		err = recordSubtask(ctx, tx, c.UserID, sid, history.ActionCreate, nil)
+		if err == nil {
+			err = tx.Commit(ctx)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "subtasks create history failed", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		w.Header().Set("ETag", etag.Format(etag.Subtask, sid, version))
+		w.Header().Set("Content-Type", "application/json")
+		if httpx.V1(r) {
+			w.Header().Set("Location", fmt.Sprintf("/api/v1/todos/%d/subtasks/%d", tid, sid))
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": todos.Subtask{ID: sid, ParentID: parent, Position: pos, Title: title, Version: version}})
+	case http.MethodDelete:
+		// The id comes from ?id= or, on the legacy route, the body.
+		sid := httpx.QueryID(r, "id")
+		if sid == 0 {
+			var body map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid json"})
+				return
+			}
+			sid = httpx.ParseID(body["id"])
 		}
 		if sid == 0 {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "missing id"})
 			return
 		}
-		_, err := pool.Exec(ctx, "DELETE FROM subtasks WHERE id=$1 AND todo_id IN (SELECT id FROM todos WHERE user_id=$2)", sid, c.UserID)
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		defer tx.Rollback(ctx)
+		if !precondition(ctx, tx, w, r, c.UserID, sid) {
+			return
+		}
+		before, _, err := history.SnapshotSubtask(ctx, tx, c.UserID, sid)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": err.Error()})
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		// The subtask's branch goes to the trash with it.
+		n, err := todos.TrashSubtask(ctx, tx, sid, time.Now())
+		if err != nil {
+			slog.ErrorContext(ctx, "subtasks delete failed", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		if n == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "not found"})
+			return
+		}
+		err = recordSubtask(ctx, tx, c.UserID, sid, history.ActionDelete, before)
+		if err == nil {
+			err = tx.Commit(ctx)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "subtasks delete history failed", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		if httpx.V1(r) {
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -155,3 +357,190 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "method not allowed"})
 	}
 }
+
+// setCompleted sets one subtask's completion state and records the change.
+func setCompleted(ctx context.Context, tx pgx.Tx, userID, sid int64, completed bool) (completion, error) {
+	st := completion{ID: sid}
+	before, _, err := history.SnapshotSubtask(ctx, tx, userID, sid)
+	if err != nil {
+		return st, err
+	}
+	err = tx.QueryRow(ctx, "UPDATE subtasks SET completed=$2, completed_at=CASE WHEN $2 THEN NOW() ELSE NULL END WHERE id=$1 RETURNING completed,completed_at,version", sid, completed).Scan(&st.Completed, &st.CompletedAt, &st.Version)
+	if err != nil {
+		return st, err
+	}
+	action := history.ActionUncomplete
+	if completed {
+		action = history.ActionComplete
+	}
+	return st, recordSubtask(ctx, tx, userID, sid, action, before)
+}
+
+// update applies a patch body to subtask sid the same way the todos endpoint
+// does.
+func update(ctx context.Context, w http.ResponseWriter, r *http.Request, pool *pgxpool.Pool, userID, sid int64, body patch.Body) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
+	defer tx.Rollback(ctx)
+	if !precondition(ctx, tx, w, r, userID, sid) {
+		return
+	}
+	before, todoID, err := history.SnapshotSubtask(ctx, tx, userID, sid)
+	var flat []todos.Subtask
+	if err == nil {
+		flat, err = todos.Flat(ctx, tx, todoID)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
+	var current todos.Subtask
+	for _, st := range flat {
+		if st.ID == sid {
+			current = st
+		}
+	}
+	doc := body.Doc
+	if body.Ops != nil {
+		cur, err := current.Document()
+		if err == nil {
+			doc, err = patch.ToMerge(cur, body.Ops)
+		}
+		if err != nil {
+			status, msg := patch.Status(err)
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": msg})
+			return
+		}
+	}
+	p, err := todos.DecodeSubtaskPatch(doc)
+	var invalid validate.Errors
+	if errors.As(err, &invalid) {
+		httpx.Invalid(w, invalid)
+		return
+	}
+	var newPos *int
+	parent := current.ParentID
+	if p.ParentID.Set || p.Position.Set {
+		if p.ParentID.Set {
+			parent = p.ParentID.Ptr()
+		}
+		if parent != nil {
+			if !contains(flat, *parent) {
+				httpx.InvalidField(w, "parentId", validate.CodeUnknownValue, "parent subtask not found")
+				return
+			}
+			if *parent == sid || containsID(todos.Descendants(flat, sid), *parent) {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "cannot move a subtask under itself"})
+				return
+			}
+		}
+		pos, err := todos.Place(ctx, tx, todoID, parent, p.Position.Ptr(), sid)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		newPos = &pos
+	}
+	var version int64
+	err = tx.QueryRow(ctx, "UPDATE subtasks SET title=CASE WHEN $1 THEN $2 ELSE title END, parent_id=CASE WHEN $4 THEN $5 ELSE parent_id END, position=COALESCE($6, position) WHERE id=$3 RETURNING version", p.Title.Set, p.Title.Value, sid, newPos != nil, parent, newPos).Scan(&version)
+	if err != nil {
+		slog.ErrorContext(ctx, "subtasks update failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
+	err = recordSubtask(ctx, tx, userID, sid, history.ActionUpdate, before)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "subtasks update history failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
+	w.Header().Set("ETag", etag.Format(etag.Subtask, sid, version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": map[string]interface{}{"id": sid, "version": version}})
+}
+
+func parsePosition(v interface{}) *int {
+	f, ok := v.(float64)
+	if !ok {
+		return nil
+	}
+	p := int(f)
+	if p < 0 {
+		p = 0
+	}
+	return &p
+}
+
+func contains(flat []todos.Subtask, id int64) bool {
+	for _, st := range flat {
+		if st.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// recordSubtask snapshots the subtask after a change and appends it to the
+// history of its todo.
+func recordSubtask(ctx context.Context, q db.Querier, userID, sid int64, action string, before json.RawMessage) error {
+	after, todoID, err := history.SnapshotSubtask(ctx, q, userID, sid)
+	if err != nil {
+		return err
+	}
+	return history.Record(ctx, q, userID, history.Entry{TodoID: todoID, SubtaskID: &sid, Entity: history.EntitySubtask, Action: action, Before: before, After: after, ActorID: userID})
+}
+
+// precondition locks the subtask and checks the If-Match header against its
+// current version. When the request must stop it writes 404, or 412 with the
+// current subtask so the client can merge, and returns false. With ?todoId=
+// the subtask must belong to that todo.
+func precondition(ctx context.Context, tx pgx.Tx, w http.ResponseWriter, r *http.Request, userID, sid int64) bool {
+	var version int64
+	err := tx.QueryRow(ctx, "SELECT s.version FROM subtasks s JOIN todos t ON t.id=s.todo_id WHERE s.id=$1 AND t.user_id=$2 AND ($3::bigint=0 OR s.todo_id=$3) AND s.deleted_at IS NULL AND t.deleted_at IS NULL FOR UPDATE OF s", sid, userID, httpx.QueryID(r, "todoId")).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "not found"})
+		return false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return false
+	}
+	if etag.Match(r.Header.Get("If-Match"), etag.Format(etag.Subtask, sid, version)) {
+		return true
+	}
+	current, err := todos.GetSubtask(ctx, tx, userID, sid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return false
+	}
+	w.Header().Set("ETag", etag.Format(etag.Subtask, sid, current.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "version conflict", "current": current})
+	return false
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/templates"
+	"chronos-task-manager/pkg/validate"
+)
+
+// Handler manages the user's todo templates. Instantiating one is done by
+// api/templates/instantiate.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "templates GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if idStr := r.URL.Query().Get("id"); idStr != "" {
+			id, _ := strconv.ParseInt(idStr, 10, 64)
+			t, err := templates.Get(ctx, pool, c.UserID, id)
+			if errors.Is(err, pgx.ErrNoRows) {
+				httpx.Error(w, http.StatusNotFound, "not found")
+				return
+			}
+			if err != nil {
+				httpx.Error(w, http.StatusInternalServerError, "db error")
+				return
+			}
+			httpx.OK(w, withPlaceholders(t))
+			return
+		}
+		list, err := templates.List(ctx, pool, c.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "templates list failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		out := make([]templateResp, 0, len(list))
+		for _, t := range list {
+			out = append(out, withPlaceholders(t))
+		}
+		httpx.OK(w, out)
+	case http.MethodPost, http.MethodPut:
+		// PUT replaces the whole template.
+		var body templates.Template
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		var invalid validate.Errors
+		if err := body.Validate(); errors.As(err, &invalid) {
+			httpx.Invalid(w, invalid)
+			return
+		}
+		var t templates.Template
+		if r.Method == http.MethodPost {
+			t, err = templates.Create(ctx, pool, c.UserID, body)
+		} else {
+			t, err = templates.Update(ctx, pool, c.UserID, body)
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "templates save failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, withPlaceholders(t))
+	case http.MethodDelete:
+		id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		tag, err := pool.Exec(ctx, "DELETE FROM todo_templates WHERE user_id=$1 AND id=$2", c.UserID, id)
+		if err != nil {
+			slog.ErrorContext(ctx, "templates delete failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpx.OK(w, nil)
+	default:
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// templateResp adds the custom placeholders a client has to ask for before
+// instantiating the template.
+type templateResp struct {
+	templates.Template
+	Placeholders []string `json:"placeholders"`
+}
+
+func withPlaceholders(t templates.Template) templateResp {
+	return templateResp{Template: t, Placeholders: t.Placeholders()}
+}
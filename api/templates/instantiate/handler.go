@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/create"
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/etag"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/templates"
+	"chronos-task-manager/pkg/validate"
+)
+
+type instantiateReq struct {
+	TemplateID interface{}       `json:"templateId"`
+	Date       string            `json:"date"`
+	Vars       map[string]string `json:"vars"`
+	ProjectID  interface{}       `json:"projectId"`
+	// CustomFields are checked against the fields of the template's group.
+	CustomFields map[string]interface{} `json:"customFields"`
+}
+
+// Handler creates a todo from a template on the given date, filling in the
+// placeholders, through the same insert path as POST /api/todos.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	var body instantiateReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.Error(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	date, err := time.Parse("2006-01-02", body.Date)
+	if err != nil {
+		httpx.Error(w, http.StatusBadRequest, "date must be YYYY-MM-DD")
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "templates instantiate GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	tpl, err := templates.Get(ctx, pool, c.UserID, httpx.ParseID(body.TemplateID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		httpx.Error(w, http.StatusNotFound, "template not found")
+		return
+	}
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	todo, err := tpl.Instantiate(date, body.Vars)
+	if err != nil {
+		httpx.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The rendered todo goes through the same checks as POST /api/todos:
+	// placeholders may have filled in an invalid time or an overlong title,
+	// and templates saved before validation may hold any group. Custom
+	// fields are checked against the fields of the template's group.
+	todo.CustomFields = body.CustomFields
+	if pid := httpx.ParseID(body.ProjectID); pid != 0 {
+		todo.ProjectID = &pid
+	}
+	created, warnings, err := create.Todo(ctx, pool, c.UserID, &todo)
+	var invalid validate.Errors
+	if errors.As(err, &invalid) {
+		httpx.Invalid(w, invalid)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "templates instantiate failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	w.Header().Set("ETag", etag.Format(etag.Todo, created.ID, created.Version))
+	resp := map[string]interface{}{"ok": true, "data": created}
+	if len(warnings) > 0 {
+		resp["warnings"] = warnings
+	}
+	httpx.JSON(w, http.StatusOK, resp)
+}
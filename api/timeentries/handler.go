@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/timetrack"
+)
+
+type entryReq struct {
+	ID        interface{} `json:"id"`
+	TodoID    interface{} `json:"todoId"`
+	SubtaskID interface{} `json:"subtaskId"`
+	StartedAt *time.Time  `json:"startedAt"`
+	EndedAt   *time.Time  `json:"endedAt"`
+	Minutes   *int        `json:"minutes"`
+	Note      *string     `json:"note"`
+}
+
+// Handler lists and edits time entries. Manual entries are logged with
+// startedAt plus either endedAt or minutes; running timers are managed by
+// api/timer.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "timeentries GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		conds := []string{"user_id=$1"}
+		args := []interface{}{c.UserID}
+		add := func(cond string, v interface{}) {
+			args = append(args, v)
+			conds = append(conds, fmt.Sprintf(cond, len(args)))
+		}
+		for _, f := range []struct{ key, cond string }{{"todoId", "todo_id=$%d"}, {"subtaskId", "subtask_id=$%d"}} {
+			v := q.Get(f.key)
+			if v == "" {
+				continue
+			}
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id <= 0 {
+				httpx.Error(w, http.StatusBadRequest, f.key+" must be a positive id")
+				return
+			}
+			add(f.cond, id)
+		}
+		for _, f := range []struct{ key, cond string }{{"from", "started_at>=$%d::date"}, {"to", "started_at<$%d::date + 1"}} {
+			v := q.Get(f.key)
+			if v == "" {
+				continue
+			}
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				httpx.Error(w, http.StatusBadRequest, f.key+" must be YYYY-MM-DD")
+				return
+			}
+			add(f.cond, v)
+		}
+		list, err := timetrack.List(ctx, pool, strings.Join(conds, " AND "), args...)
+		if err != nil {
+			slog.ErrorContext(ctx, "timeentries list failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, list)
+	case http.MethodPost:
+		var body entryReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		todoID := httpx.ParseID(body.TodoID)
+		if todoID == 0 {
+			httpx.Error(w, http.StatusBadRequest, "missing todoId")
+			return
+		}
+		var subtaskID *int64
+		if sid := httpx.ParseID(body.SubtaskID); sid != 0 {
+			subtaskID = &sid
+		}
+		if body.StartedAt == nil {
+			httpx.Error(w, http.StatusBadRequest, "startedAt is required")
+			return
+		}
+		endedAt := body.EndedAt
+		if endedAt == nil && body.Minutes != nil {
+			e := body.StartedAt.Add(time.Duration(*body.Minutes) * time.Minute)
+			endedAt = &e
+		}
+		if endedAt == nil || !endedAt.After(*body.StartedAt) {
+			httpx.Error(w, http.StatusBadRequest, "endedAt must be after startedAt, or minutes must be positive")
+			return
+		}
+		valid, err := timetrack.ValidTarget(ctx, pool, c.UserID, todoID, subtaskID)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if !valid {
+			httpx.Error(w, http.StatusNotFound, "todo not found")
+			return
+		}
+		note := ""
+		if body.Note != nil {
+			note = *body.Note
+		}
+		var id int64
+		err = pool.QueryRow(ctx, "INSERT INTO time_entries(user_id,todo_id,subtask_id,started_at,ended_at,note) VALUES($1,$2,$3,$4,$5,NULLIF($6,'')) RETURNING id", c.UserID, todoID, subtaskID, *body.StartedAt, *endedAt, note).Scan(&id)
+		if err != nil {
+			slog.ErrorContext(ctx, "timeentries insert failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		e, err := timetrack.Get(ctx, pool, c.UserID, id)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, e)
+	case http.MethodPut:
+		// Adjusts the times or note of an entry. A running timer can have its
+		// start corrected but is stopped only through api/timer.
+		var body entryReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		id := httpx.ParseID(body.ID)
+		cur, err := timetrack.Get(ctx, pool, c.UserID, id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		start, endedAt := cur.StartedAt, cur.EndedAt
+		if body.StartedAt != nil {
+			start = *body.StartedAt
+		}
+		if body.EndedAt != nil && endedAt != nil {
+			endedAt = body.EndedAt
+		}
+		if body.Minutes != nil && endedAt != nil {
+			e := start.Add(time.Duration(*body.Minutes) * time.Minute)
+			endedAt = &e
+		}
+		if (endedAt != nil && !endedAt.After(start)) || (endedAt == nil && start.After(time.Now())) {
+			httpx.Error(w, http.StatusBadRequest, "endedAt must be after startedAt")
+			return
+		}
+		if _, err := pool.Exec(ctx, "UPDATE time_entries SET started_at=$3, ended_at=$4, note=COALESCE($5, note) WHERE user_id=$1 AND id=$2", c.UserID, id, start, endedAt, body.Note); err != nil {
+			slog.ErrorContext(ctx, "timeentries update failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		e, err := timetrack.Get(ctx, pool, c.UserID, id)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, e)
+	case http.MethodDelete:
+		id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		tag, err := pool.Exec(ctx, "DELETE FROM time_entries WHERE user_id=$1 AND id=$2", c.UserID, id)
+		if err != nil {
+			slog.ErrorContext(ctx, "timeentries delete failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpx.OK(w, nil)
+	default:
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/timetrack"
+)
+
+type startReq struct {
+	TodoID    interface{} `json:"todoId"`
+	SubtaskID interface{} `json:"subtaskId"`
+	Note      string      `json:"note"`
+}
+
+// Handler manages the user's single running timer: GET returns it, POST starts
+// one (stopping whatever was running) and DELETE stops it.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "timer GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		e, err := timetrack.Running(ctx, pool, c.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "timer get failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.JSON(w, http.StatusOK, map[string]interface{}{"ok": true, "data": e})
+	case http.MethodPost:
+		var body startReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		todoID := httpx.ParseID(body.TodoID)
+		if todoID == 0 {
+			httpx.Error(w, http.StatusBadRequest, "missing todoId")
+			return
+		}
+		var subtaskID *int64
+		if sid := httpx.ParseID(body.SubtaskID); sid != 0 {
+			subtaskID = &sid
+		}
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		defer tx.Rollback(ctx)
+		valid, err := timetrack.ValidTarget(ctx, tx, c.UserID, todoID, subtaskID)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if !valid {
+			httpx.Error(w, http.StatusNotFound, "todo not found")
+			return
+		}
+		stopped, err := timetrack.Stop(ctx, tx, c.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "timer stop failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		var id int64
+		err = tx.QueryRow(ctx, "INSERT INTO time_entries(user_id,todo_id,subtask_id,started_at,note) VALUES($1,$2,$3,NOW(),NULLIF($4,'')) RETURNING id", c.UserID, todoID, subtaskID, body.Note).Scan(&id)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			// Another request started a timer at the same moment.
+			httpx.Error(w, http.StatusConflict, "a timer is already running")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "timer start failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		started, err := timetrack.Get(ctx, tx, c.UserID, id)
+		if err == nil {
+			err = tx.Commit(ctx)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "timer start commit failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, map[string]interface{}{"running": started, "stopped": stopped})
+	case http.MethodDelete:
+		e, err := timetrack.Stop(ctx, pool, c.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "timer stop failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if e == nil {
+			httpx.Error(w, http.StatusNotFound, "no timer running")
+			return
+		}
+		httpx.OK(w, e)
+	default:
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,372 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/capacity"
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/fields"
+	"chronos-task-manager/pkg/history"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/todos"
+	"chronos-task-manager/pkg/validate"
+)
+
+// maxItems bounds how many todos one bulk request may touch.
+const maxItems = 500
+
+type bulkFilter struct {
+	Date      string `json:"date"`
+	Before    string `json:"before"`
+	After     string `json:"after"`
+	Completed *bool  `json:"completed"`
+	GroupID   string `json:"groupId"`
+	Tag       string `json:"tag"`
+}
+
+type bulkReq struct {
+	Action  string        `json:"action"`
+	IDs     []interface{} `json:"ids"`
+	Filter  *bulkFilter   `json:"filter"`
+	Date    string        `json:"date"`
+	GroupID string        `json:"groupId"`
+	Tag     string        `json:"tag"`
+	Force   bool          `json:"force"`
+}
+
+type itemResult struct {
+	ID    int64  `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Handler applies one action to many todos in a single transaction. Targets
+// are either explicit ids or a filter such as
+// {"completed": false, "before": "2025-06-01"}.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	var body bulkReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.Error(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	body.Tag = strings.TrimSpace(body.Tag)
+	sql, arg, action, err := actionSQL(body)
+	var invalid validate.Errors
+	if errors.As(err, &invalid) {
+		httpx.Invalid(w, invalid)
+		return
+	}
+	if err != nil {
+		httpx.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if (len(body.IDs) == 0) == (body.Filter == nil) {
+		httpx.Error(w, http.StatusBadRequest, "provide either ids or filter")
+		return
+	}
+	if len(body.IDs) > maxItems {
+		httpx.Error(w, http.StatusBadRequest, fmt.Sprintf("at most %d ids per request", maxItems))
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "bulk GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var ids []int64
+	if body.Filter != nil {
+		where, args, err := filterSQL(c.UserID, body.Filter)
+		if err != nil {
+			httpx.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		rows, err := tx.Query(ctx, "SELECT id FROM todos WHERE "+where+fmt.Sprintf(" ORDER BY id LIMIT %d FOR UPDATE", maxItems+1), args...)
+		if err != nil {
+			slog.ErrorContext(ctx, "bulk filter failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		ids, err = pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if len(ids) > maxItems {
+			httpx.Error(w, http.StatusBadRequest, fmt.Sprintf("filter matches more than %d todos", maxItems))
+			return
+		}
+	} else {
+		// An id given twice is handled once.
+		seen := map[int64]bool{}
+		for _, v := range body.IDs {
+			id := httpx.ParseID(v)
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	blockers := map[int64][]int64{}
+	if body.Action == "complete" && !body.Force {
+		if blockers, err = todos.OpenBlockers(ctx, tx, ids); err != nil {
+			slog.ErrorContext(ctx, "bulk blockers failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+	}
+	// Moving to another group drops the custom field values the new group
+	// does not define, as PUT /api/todos does, and fails the todos that lack
+	// one of its required fields.
+	var defs []fields.Field
+	if body.Action == "group" {
+		if defs, err = fields.ForGroup(ctx, tx, c.UserID, body.GroupID); err != nil {
+			slog.ErrorContext(ctx, "bulk fields failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+	}
+	results := make([]itemResult, 0, len(ids))
+	var affected int64
+	for _, id := range ids {
+		res := itemResult{ID: id}
+		before, err := history.SnapshotTodo(ctx, tx, c.UserID, id)
+		if errors.Is(err, pgx.ErrNoRows) || id == 0 {
+			res.Error = "not found"
+			results = append(results, res)
+			continue
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "bulk snapshot failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		var current struct {
+			Tags      []string `json:"tags"`
+			DeletedAt *string  `json:"deleted_at"`
+		}
+		if err := json.Unmarshal(before, &current); err != nil {
+			slog.ErrorContext(ctx, "bulk snapshot failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if current.DeletedAt != nil {
+			res.Error = "not found"
+			results = append(results, res)
+			continue
+		}
+		if body.Action == "tag" && len(current.Tags) >= todos.MaxTags && !contains(current.Tags, body.Tag) {
+			res.Error = fmt.Sprintf("must have at most %d tags", todos.MaxTags)
+			results = append(results, res)
+			continue
+		}
+		// A blocker completed earlier in this same request no longer counts.
+		if open := stillOpen(blockers[id], results); len(open) > 0 {
+			res.Error = fmt.Sprintf("blocked by open todos %v", open)
+			results = append(results, res)
+			continue
+		}
+		args := []interface{}{c.UserID, id}
+		if arg != nil {
+			args = append(args, arg)
+		}
+		if body.Action == "group" {
+			var current map[string]interface{}
+			if err := tx.QueryRow(ctx, "SELECT custom_fields FROM todos WHERE user_id=$1 AND id=$2", c.UserID, id).Scan(&current); err != nil {
+				slog.ErrorContext(ctx, "bulk custom fields failed", "err", err)
+				httpx.Error(w, http.StatusInternalServerError, "db error")
+				return
+			}
+			kept := map[string]interface{}{}
+			for _, f := range defs {
+				if v, ok := current[f.Key]; ok {
+					kept[f.Key] = v
+				}
+			}
+			values, err := fields.Check(defs, kept)
+			if err != nil {
+				res.Error = err.Error()
+				results = append(results, res)
+				continue
+			}
+			args = append(args, values)
+		}
+		tag, err := tx.Exec(ctx, sql, args...)
+		if err != nil {
+			slog.ErrorContext(ctx, "bulk failed", "action", body.Action, "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		// The update skips todos the action would not change, such as
+		// completing a completed todo; they succeed without a history entry.
+		if tag.RowsAffected() == 0 {
+			res.OK = true
+			results = append(results, res)
+			continue
+		}
+		after, err := history.SnapshotTodo(ctx, tx, c.UserID, id)
+		if err == nil {
+			err = history.Record(ctx, tx, c.UserID, history.Entry{TodoID: id, Entity: history.EntityTodo, Action: action, Before: before, After: after, ActorID: c.UserID})
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "bulk history failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		res.OK = true
+		affected++
+		results = append(results, res)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "bulk commit failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	var warnings []string
+	if body.Action == "move" && affected > 0 {
+		if warnings, err = capacity.Check(ctx, pool, c.UserID, body.Date); err != nil {
+			slog.ErrorContext(ctx, "bulk capacity failed", "err", err)
+		}
+	}
+	resp := map[string]interface{}{"ok": true, "data": map[string]interface{}{"results": results, "affected": affected}}
+	if len(warnings) > 0 {
+		resp["warnings"] = warnings
+	}
+	httpx.JSON(w, http.StatusOK, resp)
+}
+
+// actionSQL returns the per-todo update for an action, taking $1=user id,
+// $2=todo id and optionally $3=arg, plus the history action it records. The
+// group action also takes the todo's custom fields as $4. Each update only
+// matches todos it changes.
+func actionSQL(body bulkReq) (string, interface{}, string, error) {
+	const scope = " WHERE user_id=$1 AND id=$2 AND deleted_at IS NULL"
+	switch body.Action {
+	case "complete":
+		return "UPDATE todos SET completed=true, completed_at=COALESCE(completed_at, NOW())" + scope + " AND completed IS DISTINCT FROM true", nil, history.ActionComplete, nil
+	case "uncomplete":
+		return "UPDATE todos SET completed=false, completed_at=NULL" + scope + " AND completed IS DISTINCT FROM false", nil, history.ActionUncomplete, nil
+	case "move":
+		if !validDate(body.Date) {
+			return "", nil, "", errors.New("move requires date as YYYY-MM-DD")
+		}
+		return "UPDATE todos SET date=$3::date" + scope + " AND date IS DISTINCT FROM $3::date", body.Date, history.ActionUpdate, nil
+	case "group":
+		var invalid validate.Errors
+		if !invalid.String("groupId", body.GroupID, validate.Required, validate.OneOf(todos.Groups...)) {
+			return "", nil, "", invalid
+		}
+		return "UPDATE todos SET group_id=$3, custom_fields=$4" + scope + " AND group_id IS DISTINCT FROM $3", body.GroupID, history.ActionUpdate, nil
+	case "tag", "untag":
+		var invalid validate.Errors
+		if !invalid.String("tag", body.Tag, append([]validate.Rule{validate.Required}, todos.TagRules...)...) {
+			return "", nil, "", invalid
+		}
+		if body.Action == "untag" {
+			return "UPDATE todos SET tags=array_remove(tags, $3::text)" + scope + " AND $3::text = ANY(tags)", body.Tag, history.ActionUpdate, nil
+		}
+		return "UPDATE todos SET tags=array_append(tags, $3::text)" + scope + " AND NOT ($3::text = ANY(tags))", body.Tag, history.ActionUpdate, nil
+	case "delete":
+		return "UPDATE todos SET deleted_at=NOW()" + scope, nil, history.ActionDelete, nil
+	}
+	return "", nil, "", errors.New("action must be one of complete, uncomplete, move, group, tag, untag, delete")
+}
+
+func filterSQL(userID int64, f *bulkFilter) (string, []interface{}, error) {
+	conds := []string{"user_id=$1", "deleted_at IS NULL"}
+	args := []interface{}{userID}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	for _, d := range []string{f.Date, f.Before, f.After} {
+		if d != "" && !validDate(d) {
+			return "", nil, errors.New("filter dates must be YYYY-MM-DD")
+		}
+	}
+	if f.Date != "" {
+		add("date=$%d::date", f.Date)
+	}
+	if f.Before != "" {
+		add("date<$%d::date", f.Before)
+	}
+	if f.After != "" {
+		add("date>$%d::date", f.After)
+	}
+	if f.Completed != nil {
+		add("completed=$%d", *f.Completed)
+	}
+	if f.GroupID != "" {
+		add("group_id=$%d", f.GroupID)
+	}
+	if f.Tag != "" {
+		add("$%d::text = ANY(tags)", f.Tag)
+	}
+	if len(conds) == 2 {
+		return "", nil, errors.New("filter must have at least one condition")
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func validDate(s string) bool {
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
+
+// stillOpen drops the blockers that were completed successfully earlier in
+// the request.
+func stillOpen(blockers []int64, done []itemResult) []int64 {
+	var open []int64
+	for _, b := range blockers {
+		completed := false
+		for _, r := range done {
+			if r.ID == b && r.OK {
+				completed = true
+				break
+			}
+		}
+		if !completed {
+			open = append(open, b)
+		}
+	}
+	return open
+}
@@ -3,33 +3,56 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"chronos-task-manager/pkg/auth"
+	"chronos-task-manager/pkg/capacity"
+	"chronos-task-manager/pkg/create"
 	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/etag"
+	"chronos-task-manager/pkg/fields"
+	"chronos-task-manager/pkg/history"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/logx"
+	"chronos-task-manager/pkg/page"
+	"chronos-task-manager/pkg/patch"
+	"chronos-task-manager/pkg/projects"
+	"chronos-task-manager/pkg/query"
+	"chronos-task-manager/pkg/settings"
+	"chronos-task-manager/pkg/todos"
+	"chronos-task-manager/pkg/validate"
 )
 
-type todo struct {
-	ID          int64     `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description,omitempty"`
-	Date        string    `json:"date"`
-	Time        string    `json:"time,omitempty"`
-	GroupID     string    `json:"groupId"`
-	Completed   bool      `json:"completed"`
-	Subtasks    []subtask `json:"subtasks,omitempty"`
+// completion is the PATCH response: the state after the request was applied.
+type completion struct {
+	ID          int64      `json:"id"`
+	Completed   bool       `json:"completed"`
+	CompletedAt *time.Time `json:"completedAt"`
+	Version     int64      `json:"version"`
 }
 
-type subtask struct {
-	ID        int64  `json:"id"`
-	Title     string `json:"title"`
-	Completed bool   `json:"completed"`
-}
+const (
+	defaultLimit = 100
+	maxLimit     = 500
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
 
 func Handler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("todos Handler invoked: method=%s path=%s", r.Method, r.URL.Path)
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	httpx.Deprecate(w, r, "/api/v1/todos")
 	token, err := auth.FromAuthHeader(r.Header.Get("Authorization"))
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -42,139 +65,380 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "unauthorized"})
 		return
 	}
-	ctx := context.Background()
+	logx.SetUser(r.Context(), c.UserID)
+	ctx := context.WithoutCancel(r.Context())
 	pool, err := db.GetPool(ctx)
 	if err != nil {
-		log.Printf("todos GetPool error: %v", err)
+		slog.ErrorContext(ctx, "todos GetPool failed", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
 		return
 	}
 	switch r.Method {
 	case http.MethodGet:
-		date := r.URL.Query().Get("date")
-		rows, err := pool.Query(ctx, "SELECT id,title,COALESCE(description,''),to_char(date,'YYYY-MM-DD'),COALESCE(time,''),group_id,completed FROM todos WHERE user_id=$1 AND date=$2 ORDER BY id DESC", c.UserID, date)
+		if idStr := r.URL.Query().Get("id"); idStr != "" {
+			id, _ := strconv.ParseInt(idStr, 10, 64)
+			t, err := todos.Get(ctx, pool, c.UserID, id)
+			if errors.Is(err, pgx.ErrNoRows) {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "not found"})
+				return
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+				return
+			}
+			w.Header().Set("ETag", etag.Format(etag.Todo, t.ID, t.Version))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": t})
+			return
+		}
+		q := r.URL.Query()
+		req, err := page.FromQuery(q, defaultLimit, maxLimit)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": err.Error()})
+			return
+		}
+		var invalid validate.Errors
+		for _, k := range []string{"date", "from", "to", "deadline", "deadlineFrom", "deadlineTo"} {
+			invalid.String(k, q.Get(k), validate.Date)
+		}
+		if invalid.Err() != nil {
+			httpx.Invalid(w, invalid)
+			return
+		}
+		conds := []string{"user_id=$1"}
+		args := []interface{}{c.UserID}
+		add := func(cond string, v interface{}) {
+			args = append(args, v)
+			conds = append(conds, fmt.Sprintf(cond, len(args)))
+		}
+		if v := q.Get("date"); v != "" {
+			add("date=$%d::date", v)
+		}
+		if v := q.Get("from"); v != "" {
+			add("date>=$%d::date", v)
+		}
+		if v := q.Get("to"); v != "" {
+			add("date<=$%d::date", v)
+		}
+		// Deadlines are filtered separately from the scheduled date.
+		if v := q.Get("deadline"); v != "" {
+			add("deadline=$%d::date", v)
+		}
+		if v := q.Get("deadlineFrom"); v != "" {
+			add("deadline>=$%d::date", v)
+		}
+		if v := q.Get("deadlineTo"); v != "" {
+			add("deadline<=$%d::date", v)
+		}
+		today, err := localToday(ctx, pool, c.UserID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		if q.Get("overdue") == "1" {
+			add("NOT completed AND deadline<$%d::date", today)
+		}
+		// ?query= takes the filter language, see pkg/query.
+		parsed := &query.Query{}
+		if v := strings.TrimSpace(q.Get("query")); v != "" {
+			if parsed, err = query.Parse(v); err != nil {
+				resp := map[string]interface{}{"ok": false, "error": err.Error()}
+				var qe *query.Error
+				if errors.As(err, &qe) {
+					resp["column"] = qe.Column
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(resp)
+				return
+			}
+		}
+		// Deferred todos stay hidden until their day arrives unless asked
+		// for with deferred=include, or alone with deferred=only. A query
+		// that mentions them decides for itself.
+		switch q.Get("deferred") {
+		case "include":
+		case "only":
+			add("defer_until>$%d::date", today)
+		default:
+			if !parsed.Uses("deferred") && !parsed.Uses("defer") {
+				add("(defer_until IS NULL OR defer_until<=$%d::date)", today)
+			}
+		}
+		if v := q.Get("projectId"); v != "" {
+			if v == "none" {
+				conds = append(conds, "project_id IS NULL")
+			} else {
+				id, _ := strconv.ParseInt(v, 10, 64)
+				add("project_id=$%d", id)
+			}
+		}
+		// cf.<key>=v, cf.<key>.gte=v and cf.<key>.lte=v filter on custom fields.
+		filters, err := fields.ParseFilters(q)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": err.Error()})
 			return
 		}
-		defer rows.Close()
-		var list []todo
-		var ids []int64
-		for rows.Next() {
-			var t todo
-			if err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.Date, &t.Time, &t.GroupID, &t.Completed); err != nil {
+		for _, f := range filters {
+			cond, fargs := f.SQL(len(args) + 1)
+			args = append(args, fargs...)
+			conds = append(conds, cond)
+		}
+		if v := strings.TrimSpace(q.Get("q")); v != "" {
+			add("(title ILIKE $%[1]d OR description ILIKE $%[1]d)", "%"+likeEscaper.Replace(v)+"%")
+		}
+		if cond, qargs := parsed.Where(query.Options{Today: today}, len(args)+1); cond != "" {
+			args = append(args, qargs...)
+			conds = append(conds, cond)
+		}
+		where := strings.Join(conds, " AND ")
+		var total *int64
+		if req.Total {
+			n, err := todos.Count(ctx, pool, where, args...)
+			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
 				return
 			}
-			list = append(list, t)
-			ids = append(ids, t.ID)
+			total = &n
 		}
-		if len(ids) > 0 {
-			rows2, err := pool.Query(ctx, "SELECT id,todo_id,title,completed FROM subtasks WHERE todo_id = ANY($1) ORDER BY id ASC", ids)
-			if err == nil {
-				defer rows2.Close()
-				m := map[int64][]subtask{}
-				for rows2.Next() {
-					var sid, tid int64
-					var st subtask
-					if err := rows2.Scan(&sid, &tid, &st.Title, &st.Completed); err == nil {
-						st.ID = sid
-						m[tid] = append(m[tid], st)
-					}
-				}
-				for i := range list {
-					list[i].Subtasks = m[list[i].ID]
-				}
+		// Keyset pagination on the sort keys and id: stable when rows are
+		// inserted between requests, unlike OFFSET. Without sort: in the
+		// query, todos are ordered by date.
+		keys := parsed.Sort
+		if len(keys) == 0 {
+			keys = []query.SortKey{{Field: "date", Desc: q.Get("order") != "asc"}}
+		}
+		if req.Cursor != nil {
+			cond, cargs, err := query.After(keys, *req.Cursor, len(args)+1)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": err.Error()})
+				return
 			}
+			args = append(args, cargs...)
+			where += " AND " + cond
+		}
+		list, err := todos.List(ctx, pool, where, fmt.Sprintf("%s LIMIT %d", query.OrderBy(keys, req.Backward()), req.Limit+1), args...)
+		if err != nil {
+			slog.ErrorContext(ctx, "todos list failed", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
 		}
+		list, info := page.Trim(list, req, func(t todos.Todo) page.Cursor { return query.CursorFor(keys, t) })
+		info.Total = total
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": list})
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": list, "page": info})
 	case http.MethodPost:
-		var payload todo
+		var payload todos.Todo
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid json"})
 			return
 		}
-		var id int64
-		err := pool.QueryRow(ctx, "INSERT INTO todos(user_id,title,description,date,time,group_id,completed) VALUES($1,$2,$3,$4,$5,$6,false) RETURNING id", c.UserID, payload.Title, payload.Description, payload.Date, payload.Time, payload.GroupID).Scan(&id)
+		saved, warnings, err := create.Todo(ctx, pool, c.UserID, &payload)
+		var invalid validate.Errors
+		if errors.As(err, &invalid) {
+			httpx.Invalid(w, invalid)
+			return
+		}
 		if err != nil {
+			slog.ErrorContext(ctx, "todos create failed", "err", err)
 			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": err.Error()})
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
 			return
 		}
-		if len(payload.Subtasks) > 0 {
-			for _, st := range payload.Subtasks {
-				_, _ = pool.Exec(ctx, "INSERT INTO subtasks(todo_id,title,completed) VALUES($1,$2,$3)", id, st.Title, st.Completed)
-			}
+		resp := map[string]interface{}{"ok": true, "data": saved}
+		if len(warnings) > 0 {
+			resp["warnings"] = warnings
 		}
-		payload.ID = id
-		payload.Completed = false
+		w.Header().Set("ETag", etag.Format(etag.Todo, saved.ID, saved.Version))
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": payload})
+		if httpx.V1(r) {
+			w.Header().Set("Location", fmt.Sprintf("/api/v1/todos/%d", saved.ID))
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(resp)
 	case http.MethodPut:
-		var body map[string]interface{}
-		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		// The body is a merge patch plus the todo id (or ?id=, which is how
+		// /api/v1/todos/{id} arrives): members left out keep their value and
+		// null clears them.
+		var doc map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid json"})
 			return
 		}
-		var id int64
-		switch v := body["id"].(type) {
-		case float64:
-			id = int64(v)
-		case string:
-			if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
-				id = parsed
-			}
+		var rawID interface{}
+		json.Unmarshal(doc["id"], &rawID)
+		delete(doc, "id")
+		id := httpx.QueryID(r, "id")
+		if id == 0 {
+			id = httpx.ParseID(rawID)
 		}
 		if id == 0 {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "missing id"})
 			return
 		}
-		title, _ := body["title"].(string)
-		desc, _ := body["description"].(string)
-		date, _ := body["date"].(string)
-		timeStr, _ := body["time"].(string)
-		groupId, _ := body["groupId"].(string)
-		_, err := pool.Exec(ctx, "UPDATE todos SET title=COALESCE(NULLIF($1,''),title), description=COALESCE($2,description), date=COALESCE(NULLIF($3,'')::date,date), time=COALESCE(NULLIF($4,''),time), group_id=COALESCE(NULLIF($5,''),group_id) WHERE user_id=$6 AND id=$7", title, desc, date, timeStr, groupId, c.UserID, id)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": err.Error()})
+		update(ctx, w, r, pool, c.UserID, id, patch.Body{Doc: doc})
+	case http.MethodPatch:
+		// A merge patch or JSON Patch body updates the todo given by ?id=
+		// like PUT does.
+		if body, ok, err := patch.ReadBody(r); ok {
+			id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+			if id == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "missing id"})
+				return
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid json"})
+				return
+			}
+			update(ctx, w, r, pool, c.UserID, id, body)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
-	case http.MethodPatch:
-		var body map[string]string
+		// Otherwise it sets the completion state to the given value;
+		// repeating the same request is a no-op rather than flipping it back.
+		var body struct {
+			ID        interface{} `json:"id"`
+			Completed *bool       `json:"completed"`
+			Force     bool        `json:"force"`
+		}
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid json"})
 			return
 		}
-		idStr := body["id"]
-		id, _ := strconv.ParseInt(idStr, 10, 64)
-		_, err := pool.Exec(ctx, "UPDATE todos SET completed = NOT completed WHERE user_id=$1 AND id=$2", c.UserID, id)
+		id := httpx.QueryID(r, "id")
+		if id == 0 {
+			id = httpx.ParseID(body.ID)
+		}
+		if id == 0 || body.Completed == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "id and completed are required"})
+			return
+		}
+		tx, err := pool.Begin(ctx)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
 			return
 		}
+		defer tx.Rollback(ctx)
+		if !precondition(ctx, tx, w, r, c.UserID, id) {
+			return
+		}
+		state := completion{ID: id}
+		err = tx.QueryRow(ctx, "SELECT completed,completed_at,version FROM todos WHERE user_id=$1 AND id=$2", c.UserID, id).Scan(&state.Completed, &state.CompletedAt, &state.Version)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		var warnings []string
+		if !state.Completed && *body.Completed {
+			// Completing a task whose blockers are still open is refused
+			// unless the client insists with force.
+			blockers, err := todos.OpenBlockers(ctx, tx, []int64{id})
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+				return
+			}
+			if open := blockers[id]; len(open) > 0 {
+				if !body.Force {
+					w.WriteHeader(http.StatusConflict)
+					json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "blocked by open todos", "blockedBy": open})
+					return
+				}
+				warnings = append(warnings, fmt.Sprintf("completed while blocked by %d open todo(s)", len(open)))
+			}
+		}
+		if state.Completed != *body.Completed {
+			before, err := history.SnapshotTodo(ctx, tx, c.UserID, id)
+			if err == nil {
+				err = tx.QueryRow(ctx, "UPDATE todos SET completed=$3, completed_at=CASE WHEN $3 THEN NOW() ELSE NULL END WHERE user_id=$1 AND id=$2 RETURNING completed,completed_at,version", c.UserID, id, *body.Completed).Scan(&state.Completed, &state.CompletedAt, &state.Version)
+			}
+			action := history.ActionUncomplete
+			if state.Completed {
+				action = history.ActionComplete
+			}
+			if err == nil {
+				err = recordTodo(ctx, tx, c.UserID, id, action, before)
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "todos complete failed", "err", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+				return
+			}
+		}
+		if err := tx.Commit(ctx); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		w.Header().Set("ETag", etag.Format(etag.Todo, id, state.Version))
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+		resp := map[string]interface{}{"ok": true, "data": state}
+		if len(warnings) > 0 {
+			resp["warnings"] = warnings
+		}
+		json.NewEncoder(w).Encode(resp)
 	case http.MethodDelete:
 		idStr := r.URL.Query().Get("id")
 		id, _ := strconv.ParseInt(idStr, 10, 64)
-		_, err := pool.Exec(ctx, "DELETE FROM todos WHERE user_id=$1 AND id=$2", c.UserID, id)
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		defer tx.Rollback(ctx)
+		if !precondition(ctx, tx, w, r, c.UserID, id) {
+			return
+		}
+		before, err := history.SnapshotTodo(ctx, tx, c.UserID, id)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		// Deleting moves the todo to the trash; api/trash restores or purges it.
+		tag, err := tx.Exec(ctx, "UPDATE todos SET deleted_at=NOW() WHERE user_id=$1 AND id=$2 AND deleted_at IS NULL", c.UserID, id)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
 			return
 		}
+		if tag.RowsAffected() == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "not found"})
+			return
+		}
+		err = recordTodo(ctx, tx, c.UserID, id, history.ActionDelete, before)
+		if err == nil {
+			err = tx.Commit(ctx)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "todos delete history failed", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		if httpx.V1(r) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
 	default:
@@ -182,3 +446,260 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "method not allowed"})
 	}
 }
+
+// assignable checks that todos may be put into the project. When they may
+// not it writes 400 and returns false.
+func assignable(ctx context.Context, q db.Querier, w http.ResponseWriter, userID, projectID int64) bool {
+	ok, err := projects.Assignable(ctx, q, userID, projectID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return false
+	}
+	if !ok {
+		httpx.InvalidField(w, "projectId", validate.CodeUnknownValue, "project not found or archived")
+		return false
+	}
+	return true
+}
+
+// localToday returns the current date in the user's time zone.
+func localToday(ctx context.Context, q db.Querier, userID int64) (string, error) {
+	s, err := settings.Load(ctx, q, userID)
+	if err != nil {
+		return "", err
+	}
+	return time.Now().In(s.Location()).Format("2006-01-02"), nil
+}
+
+// recordTodo snapshots the todo after a change and appends it to its history.
+func recordTodo(ctx context.Context, q db.Querier, userID, id int64, action string, before json.RawMessage) error {
+	after, err := history.SnapshotTodo(ctx, q, userID, id)
+	if err != nil {
+		return err
+	}
+	return history.Record(ctx, q, userID, history.Entry{TodoID: id, Entity: history.EntityTodo, Action: action, Before: before, After: after, ActorID: userID})
+}
+
+// update applies a patch body to todo id and writes the updated todo. A JSON
+// Patch is turned into a merge patch against the todo's current document
+// (see patch.ToMerge), so both formats go through the same checks.
+func update(ctx context.Context, w http.ResponseWriter, r *http.Request, pool *pgxpool.Pool, userID, id int64, body patch.Body) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
+	defer tx.Rollback(ctx)
+	if !precondition(ctx, tx, w, r, userID, id) {
+		return
+	}
+	current, err := todos.Get(ctx, tx, userID, id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
+	doc := body.Doc
+	if body.Ops != nil {
+		cur, err := current.Document()
+		if err == nil {
+			doc, err = patch.ToMerge(cur, body.Ops)
+		}
+		if err != nil {
+			status, msg := patch.Status(err)
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": msg})
+			return
+		}
+	}
+	p, err := todos.DecodePatch(doc)
+	var invalid validate.Errors
+	if errors.As(err, &invalid) {
+		httpx.Invalid(w, invalid)
+		return
+	}
+	if p.ProjectID.Ptr() != nil && !assignable(ctx, tx, w, userID, p.ProjectID.Value) {
+		return
+	}
+	before, err := history.SnapshotTodo(ctx, tx, userID, id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
+	// customFields is merged into the current values (null removes a key,
+	// null as a whole removes them all) and checked against the fields of
+	// the group the todo ends up in. Moving to another group drops values
+	// the new group does not define.
+	if p.CustomFields.Set || p.GroupID.Set {
+		group := current.GroupID
+		if p.GroupID.Set {
+			group = p.GroupID.Value
+		}
+		defs, err := fields.ForGroup(ctx, tx, userID, group)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		kept := map[string]interface{}{}
+		for _, f := range defs {
+			if v, ok := current.CustomFields[f.Key]; ok {
+				kept[f.Key] = v
+			}
+		}
+		var merged map[string]interface{}
+		switch {
+		case p.CustomFields.Null:
+			merged = map[string]interface{}{}
+		case p.CustomFields.Set:
+			merged, _ = patch.Merge(kept, p.CustomFields.Value).(map[string]interface{})
+		default:
+			merged = kept
+		}
+		values, err := fields.Check(defs, merged)
+		if err != nil {
+			httpx.InvalidField(w, "customFields", validate.CodeInvalid, err.Error())
+			return
+		}
+		p.CustomFields = patch.Field[map[string]interface{}]{Set: true, Value: values}
+	}
+	version, err := todos.Update(ctx, tx, userID, id, p)
+	if err != nil {
+		slog.ErrorContext(ctx, "todos update failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
+	if err := recordTodo(ctx, tx, userID, id, history.ActionUpdate, before); err != nil {
+		slog.ErrorContext(ctx, "todos update history failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
+	// subtasks, when present, is the complete checklist: subtasks with an id
+	// are updated or moved, those without are created and the ones left out
+	// go to the trash.
+	if p.Subtasks.Set {
+		flat, err := todos.Flat(ctx, tx, id)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+		plan, err := todos.PlanSubtasks(flat, p.Subtasks.Value)
+		if err != nil {
+			httpx.InvalidField(w, "subtasks", validate.CodeInvalid, err.Error())
+			return
+		}
+		if err := reconcile(ctx, tx, userID, id, plan); err != nil {
+			slog.ErrorContext(ctx, "todos subtasks failed", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+			return
+		}
+	}
+	saved, err := todos.Get(ctx, tx, userID, id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return
+	}
+	// Moving an estimated todo, or changing its estimate, may overbook the
+	// day it ends up on.
+	var warnings []string
+	if (p.Date.Set || p.EstimateMinutes.Set) && saved.EstimateMinutes != nil && *saved.EstimateMinutes > 0 {
+		if warnings, err = capacity.Check(ctx, pool, userID, saved.Date); err != nil {
+			slog.ErrorContext(ctx, "todos capacity failed", "err", err)
+		}
+	}
+	w.Header().Set("ETag", etag.Format(etag.Todo, id, version))
+	w.Header().Set("Content-Type", "application/json")
+	resp := map[string]interface{}{"ok": true, "data": saved}
+	if len(warnings) > 0 {
+		resp["warnings"] = warnings
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// reconcile applies a subtask plan and records each created, changed and
+// trashed subtask in the todo's history.
+func reconcile(ctx context.Context, tx pgx.Tx, userID, todoID int64, plan *todos.SubtaskPlan) error {
+	before := map[int64]json.RawMessage{}
+	for _, ids := range [][]int64{plan.Update, plan.Delete} {
+		for _, sid := range ids {
+			snap, _, err := history.SnapshotSubtask(ctx, tx, userID, sid)
+			if err != nil {
+				return err
+			}
+			before[sid] = snap
+		}
+	}
+	now := time.Now()
+	_, created, err := plan.Apply(ctx, tx, todoID, func(sid int64) error {
+		_, err := todos.TrashSubtask(ctx, tx, sid, now)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	record := func(ids []int64, action string) error {
+		for _, sid := range ids {
+			sid := sid
+			after, _, err := history.SnapshotSubtask(ctx, tx, userID, sid)
+			if err != nil {
+				return err
+			}
+			if err := history.Record(ctx, tx, userID, history.Entry{TodoID: todoID, SubtaskID: &sid, Entity: history.EntitySubtask, Action: action, Before: before[sid], After: after, ActorID: userID}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := record(created, history.ActionCreate); err != nil {
+		return err
+	}
+	if err := record(plan.Update, history.ActionUpdate); err != nil {
+		return err
+	}
+	return record(plan.Delete, history.ActionDelete)
+}
+
+// precondition locks the todo and checks the If-Match header against its
+// current version. When the request must stop it writes 404, or 412 with the
+// current todo so the client can merge, and returns false.
+func precondition(ctx context.Context, tx pgx.Tx, w http.ResponseWriter, r *http.Request, userID, id int64) bool {
+	var version int64
+	err := tx.QueryRow(ctx, "SELECT version FROM todos WHERE user_id=$1 AND id=$2 AND deleted_at IS NULL FOR UPDATE", userID, id).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "not found"})
+		return false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return false
+	}
+	if etag.Match(r.Header.Get("If-Match"), etag.Format(etag.Todo, id, version)) {
+		return true
+	}
+	current, err := todos.Get(ctx, tx, userID, id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "db error"})
+		return false
+	}
+	w.Header().Set("ETag", etag.Format(etag.Todo, id, current.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "version conflict", "current": current})
+	return false
+}
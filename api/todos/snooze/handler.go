@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/capacity"
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/etag"
+	"chronos-task-manager/pkg/history"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/settings"
+	"chronos-task-manager/pkg/snooze"
+)
+
+type snoozeReq struct {
+	ID    interface{} `json:"id"`
+	Until string      `json:"until"`
+	Days  int         `json:"days"`
+}
+
+type snoozed struct {
+	ID         int64   `json:"id"`
+	Date       string  `json:"date"`
+	DeferUntil *string `json:"deferUntil"`
+	Version    int64   `json:"version"`
+}
+
+// Handler snoozes a todo (POST {id, until} or {id, days}): it is hidden from
+// lists until the target day and scheduled no earlier than that day. DELETE
+// ?id= wakes it up again, leaving the scheduled date alone.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "snooze GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	var id int64
+	var target *string
+	switch r.Method {
+	case http.MethodPost:
+		var body snoozeReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		id = httpx.ParseID(body.ID)
+		s, err := settings.Load(ctx, pool, c.UserID)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		now := time.Now().In(s.Location())
+		var day string
+		if body.Until != "" {
+			day, err = snooze.Parse(body.Until, now)
+		} else {
+			day, err = snooze.Days(body.Days, now)
+		}
+		if err != nil {
+			httpx.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		target = &day
+	case http.MethodDelete:
+		id, _ = strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	default:
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	before, err := history.SnapshotTodo(ctx, tx, c.UserID, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		httpx.Error(w, http.StatusNotFound, "not found")
+		return
+	}
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	res := snoozed{ID: id}
+	var estimate *int
+	err = tx.QueryRow(ctx, "UPDATE todos SET defer_until=$3::date, date=GREATEST(date, COALESCE($3::date, date)) WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL RETURNING to_char(date,'YYYY-MM-DD'), to_char(defer_until,'YYYY-MM-DD'), version, estimate_minutes", id, c.UserID, target).
+		Scan(&res.Date, &res.DeferUntil, &res.Version, &estimate)
+	if errors.Is(err, pgx.ErrNoRows) {
+		httpx.Error(w, http.StatusNotFound, "not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "snooze update failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	after, err := history.SnapshotTodo(ctx, tx, c.UserID, id)
+	if err == nil {
+		err = history.Record(ctx, tx, c.UserID, history.Entry{TodoID: id, Entity: history.EntityTodo, Action: history.ActionUpdate, Before: before, After: after, ActorID: c.UserID})
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "snooze history failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	var warnings []string
+	if target != nil && estimate != nil && *estimate > 0 {
+		if warnings, err = capacity.Check(ctx, pool, c.UserID, res.Date); err != nil {
+			slog.ErrorContext(ctx, "snooze capacity failed", "err", err)
+		}
+	}
+	w.Header().Set("ETag", etag.Format(etag.Todo, id, res.Version))
+	resp := map[string]interface{}{"ok": true, "data": res}
+	if len(warnings) > 0 {
+		resp["warnings"] = warnings
+	}
+	httpx.JSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,285 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"chronos-task-manager/pkg/attachments"
+	"chronos-task-manager/pkg/blob"
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/history"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/todos"
+	"chronos-task-manager/pkg/trash"
+)
+
+type trashedSubtask struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Completed bool      `json:"completed"`
+	DeletedAt time.Time `json:"deletedAt,omitempty"`
+	PurgeAt   time.Time `json:"purgeAt,omitempty"`
+}
+
+type trashedTodo struct {
+	ID          int64            `json:"id"`
+	Title       string           `json:"title"`
+	Description string           `json:"description,omitempty"`
+	Date        string           `json:"date"`
+	Time        string           `json:"time,omitempty"`
+	GroupID     string           `json:"groupId"`
+	Completed   bool             `json:"completed"`
+	DeletedAt   time.Time        `json:"deletedAt"`
+	PurgeAt     time.Time        `json:"purgeAt"`
+	Subtasks    []trashedSubtask `json:"subtasks,omitempty"`
+}
+
+// orphan is a subtask deleted on its own while its todo is still live.
+type orphan struct {
+	trashedSubtask
+	TodoID    int64  `json:"todoId"`
+	TodoTitle string `json:"todoTitle"`
+}
+
+type trashReq struct {
+	Type string      `json:"type"`
+	ID   interface{} `json:"id"`
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "trash GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := pool.Query(ctx, "SELECT id,title,COALESCE(description,''),to_char(date,'YYYY-MM-DD'),COALESCE(time,''),group_id,completed,deleted_at FROM todos WHERE user_id=$1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC", c.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "trash list todos failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		todos := []trashedTodo{}
+		index := map[int64]int{}
+		var ids []int64
+		for rows.Next() {
+			var t trashedTodo
+			if err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.Date, &t.Time, &t.GroupID, &t.Completed, &t.DeletedAt); err != nil {
+				rows.Close()
+				httpx.Error(w, http.StatusInternalServerError, "db error")
+				return
+			}
+			t.PurgeAt = trash.PurgeAt(t.DeletedAt)
+			index[t.ID] = len(todos)
+			todos = append(todos, t)
+			ids = append(ids, t.ID)
+		}
+		rows.Close()
+		if len(ids) > 0 {
+			rows, err := pool.Query(ctx, "SELECT id,todo_id,title,completed FROM subtasks WHERE todo_id = ANY($1) AND deleted_at IS NULL ORDER BY id ASC", ids)
+			if err == nil {
+				for rows.Next() {
+					var st trashedSubtask
+					var tid int64
+					if err := rows.Scan(&st.ID, &tid, &st.Title, &st.Completed); err == nil {
+						todos[index[tid]].Subtasks = append(todos[index[tid]].Subtasks, st)
+					}
+				}
+				rows.Close()
+			}
+		}
+		// Nested subtasks trashed along with their parent are restored with
+		// it, so only the top of each trashed branch is listed.
+		orphans := []orphan{}
+		rows, err = pool.Query(ctx, "SELECT s.id,s.title,s.completed,s.deleted_at,t.id,t.title FROM subtasks s JOIN todos t ON t.id=s.todo_id LEFT JOIN subtasks p ON p.id=s.parent_id WHERE t.user_id=$1 AND t.deleted_at IS NULL AND s.deleted_at IS NOT NULL AND p.deleted_at IS NULL ORDER BY s.deleted_at DESC", c.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "trash list subtasks failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var o orphan
+			if err := rows.Scan(&o.ID, &o.Title, &o.Completed, &o.DeletedAt, &o.TodoID, &o.TodoTitle); err != nil {
+				httpx.Error(w, http.StatusInternalServerError, "db error")
+				return
+			}
+			o.PurgeAt = trash.PurgeAt(o.DeletedAt)
+			orphans = append(orphans, o)
+		}
+		httpx.OK(w, map[string]interface{}{"todos": todos, "subtasks": orphans, "retentionDays": int(trash.Retention().Hours() / 24)})
+	case http.MethodPost:
+		// Restore a todo (with its subtasks) or a single subtask.
+		var body trashReq
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		id := httpx.ParseID(body.ID)
+		if id == 0 {
+			httpx.Error(w, http.StatusBadRequest, "missing id")
+			return
+		}
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		defer tx.Rollback(ctx)
+		entry := history.Entry{Action: history.ActionRestore, ActorID: c.UserID}
+		var n int64
+		var snapErr error
+		switch body.Type {
+		case "todo":
+			entry.Entity, entry.TodoID = history.EntityTodo, id
+			if entry.Before, err = history.SnapshotTodo(ctx, tx, c.UserID, id); err != nil {
+				httpx.Error(w, http.StatusNotFound, "not found")
+				return
+			}
+			tag, err := tx.Exec(ctx, "UPDATE todos SET deleted_at=NULL WHERE user_id=$1 AND id=$2 AND deleted_at IS NOT NULL", c.UserID, id)
+			if err != nil {
+				slog.ErrorContext(ctx, "trash restore todo failed", "err", err)
+				httpx.Error(w, http.StatusInternalServerError, "db error")
+				return
+			}
+			n = tag.RowsAffected()
+			entry.After, snapErr = history.SnapshotTodo(ctx, tx, c.UserID, id)
+		case "subtask":
+			var todoDeleted, parentDeleted bool
+			err := tx.QueryRow(ctx, "SELECT t.deleted_at IS NOT NULL, p.deleted_at IS NOT NULL FROM subtasks s JOIN todos t ON t.id=s.todo_id LEFT JOIN subtasks p ON p.id=s.parent_id WHERE s.id=$1 AND t.user_id=$2 AND s.deleted_at IS NOT NULL", id, c.UserID).Scan(&todoDeleted, &parentDeleted)
+			if err != nil {
+				httpx.Error(w, http.StatusNotFound, "not found")
+				return
+			}
+			if todoDeleted {
+				httpx.Error(w, http.StatusConflict, "todo is in trash; restore the todo first")
+				return
+			}
+			if parentDeleted {
+				httpx.Error(w, http.StatusConflict, "parent subtask is in trash; restore it first")
+				return
+			}
+			entry.Entity, entry.SubtaskID = history.EntitySubtask, &id
+			if entry.Before, entry.TodoID, err = history.SnapshotSubtask(ctx, tx, c.UserID, id); err != nil {
+				httpx.Error(w, http.StatusNotFound, "not found")
+				return
+			}
+			if n, err = todos.RestoreSubtask(ctx, tx, id); err != nil {
+				slog.ErrorContext(ctx, "trash restore subtask failed", "err", err)
+				httpx.Error(w, http.StatusInternalServerError, "db error")
+				return
+			}
+			entry.After, _, snapErr = history.SnapshotSubtask(ctx, tx, c.UserID, id)
+		default:
+			httpx.Error(w, http.StatusBadRequest, "type must be todo or subtask")
+			return
+		}
+		if n == 0 {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		err = snapErr
+		if err == nil {
+			err = history.Record(ctx, tx, c.UserID, entry)
+		}
+		if err == nil {
+			err = tx.Commit(ctx)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "trash restore failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, nil)
+	case http.MethodDelete:
+		// Permanently delete one trashed item, or everything with ?all=1.
+		q := r.URL.Query()
+		id, _ := strconv.ParseInt(q.Get("id"), 10, 64)
+		all := q.Get("all") == "1"
+		if !all && q.Get("type") == "subtask" {
+			if id == 0 {
+				httpx.Error(w, http.StatusBadRequest, "missing id")
+				return
+			}
+			tag, err := pool.Exec(ctx, "DELETE FROM subtasks WHERE id=$1 AND deleted_at IS NOT NULL AND todo_id IN (SELECT id FROM todos WHERE user_id=$2)", id, c.UserID)
+			if err != nil {
+				slog.ErrorContext(ctx, "trash delete failed", "err", err)
+				httpx.Error(w, http.StatusInternalServerError, "db error")
+				return
+			}
+			if tag.RowsAffected() == 0 {
+				httpx.Error(w, http.StatusNotFound, "not found")
+				return
+			}
+			httpx.OK(w, nil)
+			return
+		}
+		if !all && q.Get("type") != "todo" {
+			httpx.Error(w, http.StatusBadRequest, "type must be todo or subtask")
+			return
+		}
+		if !all && id == 0 {
+			httpx.Error(w, http.StatusBadRequest, "missing id")
+			return
+		}
+		store, err := blob.FromEnv()
+		if err != nil {
+			slog.ErrorContext(ctx, "trash store failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "storage not configured")
+			return
+		}
+		// Todos and their attachment rows go in one transaction; the files
+		// are removed only after it commits, so a failed or empty delete
+		// never leaves a todo without its files.
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		defer tx.Rollback(ctx)
+		var n int64
+		var keys []string
+		if all {
+			_, err = tx.Exec(ctx, "DELETE FROM subtasks WHERE deleted_at IS NOT NULL AND todo_id IN (SELECT id FROM todos WHERE user_id=$1)", c.UserID)
+			if err == nil {
+				_, keys, err = trash.DropTodos(ctx, tx, "user_id=$1", c.UserID)
+			}
+		} else {
+			n, keys, err = trash.DropTodos(ctx, tx, "id=$1 AND user_id=$2", id, c.UserID)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "trash delete failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if !all && n == 0 {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			slog.ErrorContext(ctx, "trash delete commit failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		attachments.RemoveBlobs(ctx, store, keys)
+		httpx.OK(w, nil)
+	default:
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/settings"
+	"chronos-task-manager/pkg/views"
+)
+
+type viewCount struct {
+	ViewID int64 `json:"viewId"`
+	Open   int64 `json:"open"`
+}
+
+// Handler returns how many open todos each of the user's views matches, in
+// sidebar order, for badges next to the view names.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodGet {
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "views counts GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	s, err := settings.Load(ctx, pool, c.UserID)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	list, err := views.List(ctx, pool, c.UserID)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	counts, err := views.Counts(ctx, pool, c.UserID, list, time.Now().In(s.Location()).Format("2006-01-02"))
+	if err != nil {
+		slog.ErrorContext(ctx, "views counts failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	out := make([]viewCount, 0, len(list))
+	for _, v := range list {
+		if n, ok := counts[v.ID]; ok {
+			out = append(out, viewCount{ViewID: v.ID, Open: n})
+		}
+	}
+	httpx.OK(w, out)
+}
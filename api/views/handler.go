@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/views"
+)
+
+// Handler manages the user's saved views. Reordering, counts and evaluation
+// live in api/views/reorder, api/views/counts and api/views/todos.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "views GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if idStr := r.URL.Query().Get("id"); idStr != "" {
+			id, _ := strconv.ParseInt(idStr, 10, 64)
+			v, err := views.Get(ctx, pool, c.UserID, id)
+			if errors.Is(err, pgx.ErrNoRows) {
+				httpx.Error(w, http.StatusNotFound, "not found")
+				return
+			}
+			if err != nil {
+				httpx.Error(w, http.StatusInternalServerError, "db error")
+				return
+			}
+			httpx.OK(w, v)
+			return
+		}
+		list, err := views.List(ctx, pool, c.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "views list failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, list)
+	case http.MethodPost, http.MethodPut:
+		// PUT replaces name, query, sort and groupBy; the position only
+		// changes through api/views/reorder.
+		var body views.View
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httpx.Error(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if err := body.Validate(); err != nil {
+			httpx.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var v views.View
+		if r.Method == http.MethodPost {
+			v, err = views.Create(ctx, pool, c.UserID, body)
+		} else {
+			v, err = views.Update(ctx, pool, c.UserID, body)
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "views save failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, v)
+	case http.MethodDelete:
+		id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		defer tx.Rollback(ctx)
+		var pos int
+		err = tx.QueryRow(ctx, "DELETE FROM saved_views WHERE user_id=$1 AND id=$2 RETURNING position", c.UserID, id).Scan(&pos)
+		if errors.Is(err, pgx.ErrNoRows) {
+			httpx.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err == nil {
+			// Close the gap so positions stay 0..n-1.
+			_, err = tx.Exec(ctx, "UPDATE saved_views SET position=position-1 WHERE user_id=$1 AND position>$2", c.UserID, pos)
+		}
+		if err == nil {
+			err = tx.Commit(ctx)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "views delete failed", "err", err)
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		httpx.OK(w, nil)
+	default:
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/httpx"
+	"chronos-task-manager/pkg/page"
+	"chronos-task-manager/pkg/query"
+	"chronos-task-manager/pkg/settings"
+	"chronos-task-manager/pkg/todos"
+	"chronos-task-manager/pkg/views"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 500
+)
+
+// Handler evaluates a saved view: GET ?id= returns a page of the matching
+// todos with their subtasks in the view's order, grouped when the view has
+// a groupBy.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	httpx.Serve(w, r, handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	c, ok := httpx.User(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodGet {
+		httpx.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	req, err := page.FromQuery(q, defaultLimit, maxLimit)
+	if err != nil {
+		httpx.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	pool, err := db.GetPool(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "views todos GetPool failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	id, _ := strconv.ParseInt(q.Get("id"), 10, 64)
+	v, err := views.Get(ctx, pool, c.UserID, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		httpx.Error(w, http.StatusNotFound, "not found")
+		return
+	}
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	plan, err := v.Plan()
+	if err != nil {
+		// Saved views are validated, so this only happens when the
+		// language changed underneath an old view.
+		httpx.Error(w, http.StatusUnprocessableEntity, "view no longer valid: "+err.Error())
+		return
+	}
+	s, err := settings.Load(ctx, pool, c.UserID)
+	if err != nil {
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	today := time.Now().In(s.Location()).Format("2006-01-02")
+
+	args := []interface{}{c.UserID}
+	cond, cargs := plan.Where(today, 2)
+	args = append(args, cargs...)
+	where := "user_id=$1 AND " + cond
+	var total *int64
+	if req.Total {
+		n, err := todos.Count(ctx, pool, where, args...)
+		if err != nil {
+			httpx.Error(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		total = &n
+	}
+	if req.Cursor != nil {
+		after, aargs, err := query.After(plan.Sort, *req.Cursor, len(args)+1)
+		if err != nil {
+			httpx.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		args = append(args, aargs...)
+		where += " AND " + after
+	}
+	list, err := todos.List(ctx, pool, where, fmt.Sprintf("%s LIMIT %d", query.OrderBy(plan.Sort, req.Backward()), req.Limit+1), args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "views todos list failed", "err", err)
+		httpx.Error(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	list, info := page.Trim(list, req, func(t todos.Todo) page.Cursor { return query.CursorFor(plan.Sort, t) })
+	info.Total = total
+	res := map[string]interface{}{"ok": true, "data": list, "page": info, "view": v}
+	if v.GroupBy != views.GroupNone {
+		res["groups"] = views.Groups(v.GroupBy, list)
+	}
+	httpx.JSON(w, http.StatusOK, res)
+}
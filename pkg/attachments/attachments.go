@@ -0,0 +1,165 @@
+package attachments
+
+import (
+	"context"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"chronos-task-manager/pkg/blob"
+	"chronos-task-manager/pkg/db"
+)
+
+// Defaults for ATTACHMENT_MAX_BYTES and ATTACHMENT_QUOTA_BYTES. Vercel caps
+// request bodies at 4.5 MB, so a single file stays below that.
+const (
+	DefaultMaxBytes   = 4 << 20
+	DefaultQuotaBytes = 100 << 20
+)
+
+// allowed lists the accepted content types, as sniffed from the file itself.
+var allowed = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+type Attachment struct {
+	ID          int64     `json:"id"`
+	TodoID      int64     `json:"todoId"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+	StorageKey  string    `json:"-"`
+}
+
+// MaxBytes is the largest accepted file.
+func MaxBytes() int64 {
+	return envBytes("ATTACHMENT_MAX_BYTES", DefaultMaxBytes)
+}
+
+// QuotaBytes is how much a user may store in total.
+func QuotaBytes() int64 {
+	return envBytes("ATTACHMENT_QUOTA_BYTES", DefaultQuotaBytes)
+}
+
+func envBytes(name string, def int64) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(os.Getenv(name)), 10, 64)
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
+
+// DetectType sniffs the content type of data and reports whether it is
+// accepted. Parameters such as charset are dropped.
+func DetectType(data []byte) (string, bool) {
+	t, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return "", false
+	}
+	return t, allowed[t]
+}
+
+// CleanFilename keeps the base name of an uploaded file and strips characters
+// that would break a Content-Disposition header.
+func CleanFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "file"
+	}
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+const columns = "id,todo_id,filename,content_type,size_bytes,created_at,storage_key"
+
+// List returns the attachments matching where (a condition on attachments
+// using $1.. placeholders), oldest first.
+func List(ctx context.Context, q db.Querier, where string, args ...any) ([]Attachment, error) {
+	rows, err := q.Query(ctx, "SELECT "+columns+" FROM attachments WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.TodoID, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt, &a.StorageKey); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// Used returns the bytes the user has stored.
+func Used(ctx context.Context, q db.Querier, userID int64) (int64, error) {
+	var n int64
+	err := q.QueryRow(ctx, "SELECT COALESCE(SUM(size_bytes),0) FROM attachments WHERE user_id=$1", userID).Scan(&n)
+	return n, err
+}
+
+// Delete removes the attachment rows matching where and then their blobs.
+// A blob that cannot be removed is logged and left behind; the row is gone
+// either way, so it no longer counts towards the quota. Inside a transaction
+// use DeleteRows and RemoveBlobs instead.
+func Delete(ctx context.Context, q db.Querier, store blob.Store, where string, args ...any) (int, error) {
+	keys, err := DeleteRows(ctx, q, where, args...)
+	if err != nil {
+		return 0, err
+	}
+	RemoveBlobs(ctx, store, keys)
+	return len(keys), nil
+}
+
+// DeleteRows removes the attachment rows matching where and returns their
+// storage keys. When q is a transaction, pass the keys to RemoveBlobs only
+// after it commits, so that a rollback never leaves rows without files.
+func DeleteRows(ctx context.Context, q db.Querier, where string, args ...any) ([]string, error) {
+	rows, err := q.Query(ctx, "DELETE FROM attachments WHERE "+where+" RETURNING storage_key", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RemoveBlobs removes the stored files of deleted attachments. A blob that
+// cannot be removed is logged and left behind.
+func RemoveBlobs(ctx context.Context, store blob.Store, keys []string) {
+	for _, k := range keys {
+		if err := store.Delete(ctx, k); err != nil {
+			slog.WarnContext(ctx, "attachments delete blob failed", "key", k, "err", err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package attachments
+
+import "testing"
+
+func TestDetectType(t *testing.T) {
+	cases := []struct {
+		data string
+		typ  string
+		ok   bool
+	}{
+		{"\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "image/png", true},
+		{"%PDF-1.7\n", "application/pdf", true},
+		{"just some notes\n", "text/plain", true},
+		{"<html><body>hi</body></html>", "text/html", false},
+		{"MZ\x90\x00\x03\x00\x00\x00", "application/octet-stream", false},
+	}
+	for _, c := range cases {
+		typ, ok := DetectType([]byte(c.data))
+		if typ != c.typ || ok != c.ok {
+			t.Errorf("DetectType(%q) = %q, %v; want %q, %v", c.data, typ, ok, c.typ, c.ok)
+		}
+	}
+}
+
+func TestCleanFilename(t *testing.T) {
+	cases := map[string]string{
+		"report.pdf":           "report.pdf",
+		`C:\Users\me\shot.png`: "shot.png",
+		"../../etc/passwd":     "passwd",
+		"a\"b\r\n.txt":         "ab.txt",
+		"   ":                  "file",
+		"dir/":                 "file",
+		"截图 2025-03-01.png":    "截图 2025-03-01.png",
+	}
+	for in, want := range cases {
+		if got := CleanFilename(in); got != want {
+			t.Errorf("CleanFilename(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLimitsFromEnv(t *testing.T) {
+	t.Setenv("ATTACHMENT_MAX_BYTES", "1024")
+	t.Setenv("ATTACHMENT_QUOTA_BYTES", "nope")
+	if MaxBytes() != 1024 {
+		t.Errorf("MaxBytes = %d", MaxBytes())
+	}
+	if QuotaBytes() != DefaultQuotaBytes {
+		t.Errorf("QuotaBytes = %d", QuotaBytes())
+	}
+}
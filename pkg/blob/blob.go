@@ -0,0 +1,70 @@
+// Package blob stores file contents such as attachments outside the database.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when no blob is stored under the key.
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs under slash-separated keys such as "12/345/9f86d0...".
+// Deleting a missing key is not an error.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// FromEnv returns the store selected by BLOB_BACKEND: "local" keeps files
+// under BLOB_DIR, "s3" talks to an S3-compatible service configured through
+// the S3_* variables. There is no default: on serverless hosts the local
+// disk belongs to one instance and is wiped when it is recycled, so falling
+// back to it would lose uploads without saying so.
+func FromEnv() (Store, error) {
+	switch backend := strings.ToLower(os.Getenv("BLOB_BACKEND")); backend {
+	case "":
+		return nil, errors.New("BLOB_BACKEND is not set: expect s3 or local")
+	case "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			return nil, errors.New("BLOB_DIR is required for the local backend")
+		}
+		return &Local{Dir: dir}, nil
+	case "s3":
+		s := &S3{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		}
+		if s.Region == "" {
+			s.Region = "us-east-1"
+		}
+		if s.Endpoint == "" || s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+			return nil, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown BLOB_BACKEND %q", backend)
+	}
+}
+
+// validKey rejects keys that could escape the store's root.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package capacity
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/settings"
+)
+
+// Day is the planned load of one day against the user's capacity.
+type Day struct {
+	Date            string `json:"date"`
+	PlannedMinutes  int    `json:"plannedMinutes"`
+	CapacityMinutes int    `json:"capacityMinutes"`
+	Overbooked      bool   `json:"overbooked"`
+}
+
+// Evaluate compares the planned minutes per day (keyed YYYY-MM-DD) with the
+// capacity from s. Days are returned in date order.
+func Evaluate(s settings.Settings, planned map[string]int) []Day {
+	days := make([]Day, 0, len(planned))
+	for date, mins := range planned {
+		d, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			continue
+		}
+		c := s.CapacityOn(d)
+		days = append(days, Day{Date: date, PlannedMinutes: mins, CapacityMinutes: c, Overbooked: mins > c})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days
+}
+
+// Warnings describes the overbooked days.
+func Warnings(days []Day) []string {
+	var out []string
+	for _, d := range days {
+		if d.Overbooked {
+			out = append(out, fmt.Sprintf("%s is over capacity: %d of %d minutes planned", d.Date, d.PlannedMinutes, d.CapacityMinutes))
+		}
+	}
+	return out
+}
+
+// Planned sums the estimates of the user's live todos on each of dates.
+func Planned(ctx context.Context, q db.Querier, userID int64, dates []string) (map[string]int, error) {
+	rows, err := q.Query(ctx, "SELECT to_char(date,'YYYY-MM-DD'), COALESCE(SUM(estimate_minutes),0) FROM todos WHERE user_id=$1 AND deleted_at IS NULL AND date = ANY($2::date[]) GROUP BY date", userID, dates)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	m := make(map[string]int, len(dates))
+	for _, d := range dates {
+		m[d] = 0
+	}
+	for rows.Next() {
+		var d string
+		var mins int
+		if err := rows.Scan(&d, &mins); err != nil {
+			return nil, err
+		}
+		m[d] = mins
+	}
+	return m, rows.Err()
+}
+
+// Check returns warnings for those of dates that are over the user's
+// capacity. It is called after a todo was created or changed so the client
+// can flag the day, outside the write's transaction: a failed check is only
+// logged and must not abort the write.
+func Check(ctx context.Context, q db.Querier, userID int64, dates ...string) ([]string, error) {
+	s, err := settings.Load(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	planned, err := Planned(ctx, q, userID, dates)
+	if err != nil {
+		return nil, err
+	}
+	return Warnings(Evaluate(s, planned)), nil
+}
@@ -0,0 +1,26 @@
+package capacity
+
+import (
+	"reflect"
+	"testing"
+
+	"chronos-task-manager/pkg/settings"
+)
+
+func TestEvaluate(t *testing.T) {
+	s := settings.Settings{DailyCapacityMinutes: 480, WeekdayCapacity: map[string]int{"sat": 0, "fri": 240}}
+	// 2025-03-07 is a Friday, 2025-03-08 a Saturday.
+	days := Evaluate(s, map[string]int{"2025-03-08": 30, "2025-03-06": 480, "2025-03-07": 300})
+	want := []Day{
+		{Date: "2025-03-06", PlannedMinutes: 480, CapacityMinutes: 480},
+		{Date: "2025-03-07", PlannedMinutes: 300, CapacityMinutes: 240, Overbooked: true},
+		{Date: "2025-03-08", PlannedMinutes: 30, CapacityMinutes: 0, Overbooked: true},
+	}
+	if !reflect.DeepEqual(days, want) {
+		t.Fatalf("days = %+v", days)
+	}
+	w := Warnings(days)
+	if len(w) != 2 || w[0] != "2025-03-07 is over capacity: 300 of 240 minutes planned" {
+		t.Fatalf("warnings = %q", w)
+	}
+}
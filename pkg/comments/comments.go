@@ -0,0 +1,132 @@
+package comments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/page"
+)
+
+// MaxBodyLength is the longest comment accepted, in characters.
+const MaxBodyLength = 10000
+
+var (
+	ErrEmptyBody   = errors.New("body is required")
+	ErrBodyTooLong = fmt.Errorf("body must be at most %d characters", MaxBodyLength)
+)
+
+// Comment is a note on a todo. Body is Markdown and stored as written;
+// rendering is left to the client.
+type Comment struct {
+	ID        int64      `json:"id"`
+	TodoID    int64      `json:"todoId"`
+	AuthorID  int64      `json:"authorId"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	Edited    bool       `json:"edited"`
+}
+
+// CleanBody trims surrounding blank lines and spaces and checks the length.
+func CleanBody(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", ErrEmptyBody
+	}
+	if utf8.RuneCountInString(s) > MaxBodyLength {
+		return "", ErrBodyTooLong
+	}
+	return s, nil
+}
+
+const columns = "id,todo_id,user_id,body,created_at,updated_at"
+
+func scan(row interface{ Scan(...any) error }, c *Comment) error {
+	if err := row.Scan(&c.ID, &c.TodoID, &c.AuthorID, &c.Body, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return err
+	}
+	c.Edited = c.UpdatedAt != nil
+	return nil
+}
+
+// List returns one page of a todo's comments, oldest first.
+func List(ctx context.Context, q db.Querier, todoID int64, req page.Request) ([]Comment, page.Info, error) {
+	var info page.Info
+	if req.Total {
+		var n int64
+		if err := q.QueryRow(ctx, "SELECT COUNT(*) FROM todo_comments WHERE todo_id=$1", todoID).Scan(&n); err != nil {
+			return nil, info, err
+		}
+		info.Total = &n
+	}
+	sql := "SELECT " + columns + " FROM todo_comments WHERE todo_id=$1"
+	args := []any{todoID}
+	order := "ASC"
+	if req.Cursor != nil {
+		args = append(args, req.Cursor.ID)
+		if req.Backward() {
+			sql += " AND id<$2"
+			order = "DESC"
+		} else {
+			sql += " AND id>$2"
+		}
+	}
+	rows, err := q.Query(ctx, fmt.Sprintf("%s ORDER BY id %s LIMIT %d", sql, order, req.Limit+1), args...)
+	if err != nil {
+		return nil, info, err
+	}
+	defer rows.Close()
+	list := []Comment{}
+	for rows.Next() {
+		var c Comment
+		if err := scan(rows, &c); err != nil {
+			return nil, info, err
+		}
+		list = append(list, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, info, err
+	}
+	list, pi := page.Trim(list, req, func(c Comment) page.Cursor { return page.Cursor{ID: c.ID} })
+	pi.Total = info.Total
+	return list, pi, nil
+}
+
+// Create adds a comment by userID to a todo.
+func Create(ctx context.Context, q db.Querier, userID, todoID int64, body string) (Comment, error) {
+	var c Comment
+	err := scan(q.QueryRow(ctx, "INSERT INTO todo_comments(todo_id,user_id,body) VALUES($1,$2,$3) RETURNING "+columns, todoID, userID, body), &c)
+	return c, err
+}
+
+// Update replaces the body of a comment written by userID on a live todo and
+// marks it edited. It returns pgx.ErrNoRows when there is no such comment.
+func Update(ctx context.Context, q db.Querier, userID, id int64, body string) (Comment, error) {
+	var c Comment
+	err := scan(q.QueryRow(ctx, "UPDATE todo_comments SET body=$3, updated_at=NOW() WHERE id=$1 AND user_id=$2 AND todo_id IN (SELECT id FROM todos WHERE deleted_at IS NULL) RETURNING "+columns, id, userID, body), &c)
+	return c, err
+}
+
+// Counts returns the number of comments per todo for the given ids.
+func Counts(ctx context.Context, q db.Querier, ids []int64) (map[int64]int, error) {
+	rows, err := q.Query(ctx, "SELECT todo_id, COUNT(*) FROM todo_comments WHERE todo_id = ANY($1) GROUP BY todo_id", ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	m := map[int64]int{}
+	for rows.Next() {
+		var id int64
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		m[id] = n
+	}
+	return m, rows.Err()
+}
@@ -0,0 +1,22 @@
+package comments
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCleanBody(t *testing.T) {
+	got, err := CleanBody("\n  **done** with step 1\n- next: review\n\n")
+	if err != nil || got != "**done** with step 1\n- next: review" {
+		t.Fatalf("CleanBody = %q, %v", got, err)
+	}
+	if _, err := CleanBody(" \n\t"); err != ErrEmptyBody {
+		t.Errorf("blank body: %v", err)
+	}
+	if _, err := CleanBody(strings.Repeat("字", MaxBodyLength)); err != nil {
+		t.Errorf("body at limit: %v", err)
+	}
+	if _, err := CleanBody(strings.Repeat("a", MaxBodyLength+1)); err != ErrBodyTooLong {
+		t.Errorf("long body: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Package create writes new todos. POST /api/todos and template
+// instantiation both go through Todo, so a todo is checked and recorded the
+// same way whichever way it is created.
+package create
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"chronos-task-manager/pkg/capacity"
+	"chronos-task-manager/pkg/fields"
+	"chronos-task-manager/pkg/history"
+	"chronos-task-manager/pkg/projects"
+	"chronos-task-manager/pkg/todos"
+	"chronos-task-manager/pkg/validate"
+)
+
+// Todo validates t and inserts it with its subtasks and a history entry in
+// one transaction. The project and the custom fields are checked inside that
+// transaction, so a project archived meanwhile cannot be assigned. Invalid
+// input is returned as validate.Errors.
+//
+// It returns the saved todo and, when t has an estimate, warnings for its day
+// going over capacity. The capacity check runs after the commit and a failed
+// check is only logged.
+func Todo(ctx context.Context, pool *pgxpool.Pool, userID int64, t *todos.Todo) (*todos.Todo, []string, error) {
+	if err := t.Validate(); err != nil {
+		return nil, nil, err
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+	var invalid validate.Errors
+	if t.ProjectID != nil {
+		ok, err := projects.Assignable(ctx, tx, userID, *t.ProjectID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			invalid.Add("projectId", validate.CodeUnknownValue, "project not found or archived")
+			return nil, nil, invalid
+		}
+	}
+	defs, err := fields.ForGroup(ctx, tx, userID, t.GroupID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.CustomFields, err = fields.Check(defs, t.CustomFields); err != nil {
+		invalid.Add("customFields", validate.CodeInvalid, err.Error())
+		return nil, nil, invalid
+	}
+	if err := todos.Insert(ctx, tx, userID, t); err != nil {
+		return nil, nil, err
+	}
+	after, err := history.SnapshotTodo(ctx, tx, userID, t.ID)
+	if err == nil {
+		err = history.Record(ctx, tx, userID, history.Entry{TodoID: t.ID, Entity: history.EntityTodo, Action: history.ActionCreate, After: after, ActorID: userID})
+	}
+	var saved *todos.Todo
+	if err == nil {
+		saved, err = todos.Get(ctx, tx, userID, t.ID)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var warnings []string
+	if saved.EstimateMinutes != nil && *saved.EstimateMinutes > 0 {
+		if warnings, err = capacity.Check(ctx, pool, userID, saved.Date); err != nil {
+			slog.ErrorContext(ctx, "todos capacity failed", "err", err)
+			warnings = nil
+		}
+	}
+	return saved, warnings, nil
+}
@@ -3,15 +3,28 @@ package db
 import (
     "context"
     "errors"
-    "log"
+    "log/slog"
     "os"
     "strings"
     "sync"
     "time"
 
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgconn"
     "github.com/jackc/pgx/v5/pgxpool"
+
+    // Configures the default logger before init below may log.
+    _ "chronos-task-manager/pkg/logx"
 )
 
+// Querier is satisfied by both *pgxpool.Pool and pgx.Tx, so helpers in other
+// packages can run either standalone or inside a handler's transaction.
+type Querier interface {
+    Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+    Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+    QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 var pool *pgxpool.Pool
 var initOnce sync.Once
 
@@ -19,17 +32,6 @@ func GetPool(ctx context.Context) (*pgxpool.Pool, error) {
     if pool != nil {
         return pool, nil
     }
-    candidates := []string{
-        "POSTGRES_URL",
-        "DATABASE_URL",
-        "POSTGRES_URL_NON_POOLING",
-        "DATABASE_URL_UNPOOLED",
-        "POSTGRES_PRISMA_URL",
-        "POSTGRES_URL_NO_SSL",
-    }
-    for _, k := range candidates {
-        log.Printf("db env %s present=%t", k, os.Getenv(k) != "")
-    }
     url := firstNonEmpty(
         os.Getenv("POSTGRES_URL"),
         os.Getenv("DATABASE_URL"),
@@ -56,7 +58,7 @@ func GetPool(ctx context.Context) (*pgxpool.Pool, error) {
     case os.Getenv("POSTGRES_URL_NO_SSL") != "":
         chosen = "POSTGRES_URL_NO_SSL"
     }
-    log.Printf("db GetPool selecting url from %s", chosen)
+    slog.DebugContext(ctx, "db selecting url", "env", chosen)
     if !strings.Contains(url, "sslmode=") {
         if strings.Contains(url, "?") {
             url += "&sslmode=require"
@@ -66,19 +68,19 @@ func GetPool(ctx context.Context) (*pgxpool.Pool, error) {
     }
     cfg, err := pgxpool.ParseConfig(url)
     if err != nil {
-        log.Printf("db ParseConfig error: %v", err)
+        slog.ErrorContext(ctx, "db ParseConfig failed", "err", err)
         return nil, err
     }
     cfg.MaxConns = 4
     cfg.MaxConnLifetime = 30 * time.Minute
     p, err := pgxpool.NewWithConfig(ctx, cfg)
     if err != nil {
-        log.Printf("db NewWithConfig error: %v", err)
+        slog.ErrorContext(ctx, "db NewWithConfig failed", "err", err)
         return nil, err
     }
     // DDL 迁移已移除；请在数据库中手动执行必要的 SQL 以创建/更新表结构
     pool = p
-    log.Printf("db pool initialized")
+    slog.DebugContext(ctx, "db pool initialized")
     return pool, nil
 }
 
@@ -86,7 +88,7 @@ func GetPool(ctx context.Context) (*pgxpool.Pool, error) {
 func init() {
 	initOnce.Do(func() {
 		if _, err := GetPool(context.Background()); err != nil {
-			log.Printf("db init on cold start failed: %v", err)
+			slog.Error("db init on cold start failed", "err", err)
 		}
 	})
 }
@@ -0,0 +1,19 @@
+package db
+
+import "context"
+
+// Classes of per-user advisory locks. Each feature locks in its own class so
+// that holding one user's lock for, say, an upload does not block that
+// user's dependency edits.
+const (
+	LockDependencies int32 = iota + 1
+	LockAttachments
+)
+
+// LockUser takes the transaction-scoped advisory lock of userID in class. It
+// is released when the transaction ends. Ids beyond the int4 range wrap,
+// which at worst makes two users share a lock.
+func LockUser(ctx context.Context, q Querier, class int32, userID int64) error {
+	_, err := q.Exec(ctx, "SELECT pg_advisory_xact_lock($1, ($2::bigint % 2147483648)::int)", class, userID)
+	return err
+}
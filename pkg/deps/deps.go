@@ -0,0 +1,97 @@
+package deps
+
+import (
+	"context"
+
+	"chronos-task-manager/pkg/db"
+)
+
+// Edge says TodoID cannot start until BlockedBy is done.
+type Edge struct {
+	TodoID    int64 `json:"todoId"`
+	BlockedBy int64 `json:"blockedBy"`
+}
+
+// Load returns every dependency edge between the user's todos, including
+// todos in the trash, so cycle checks see the whole graph.
+func Load(ctx context.Context, q db.Querier, userID int64) ([]Edge, error) {
+	rows, err := q.Query(ctx, "SELECT todo_id,blocked_by FROM todo_dependencies WHERE user_id=$1", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var edges []Edge
+	for rows.Next() {
+		var e Edge
+		if err := rows.Scan(&e.TodoID, &e.BlockedBy); err != nil {
+			return nil, err
+		}
+		edges = append(edges, e)
+	}
+	return edges, rows.Err()
+}
+
+// CyclePath reports whether adding todo -> blockedBy to edges would create a
+// cycle. If so it returns the cycle as a list of todo ids starting and ending
+// at todo, following blocked-by edges; otherwise nil.
+func CyclePath(edges []Edge, todo, blockedBy int64) []int64 {
+	if todo == blockedBy {
+		return []int64{todo, todo}
+	}
+	next := map[int64][]int64{}
+	for _, e := range edges {
+		next[e.TodoID] = append(next[e.TodoID], e.BlockedBy)
+	}
+	// Breadth-first search from blockedBy back to todo.
+	prev := map[int64]int64{blockedBy: 0}
+	queue := []int64{blockedBy}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur == todo {
+			path := []int64{}
+			for n := todo; n != 0; n = prev[n] {
+				path = append([]int64{n}, path...)
+			}
+			return append([]int64{todo}, path...)
+		}
+		for _, n := range next[cur] {
+			if _, seen := prev[n]; !seen {
+				prev[n] = cur
+				queue = append(queue, n)
+			}
+		}
+	}
+	return nil
+}
+
+// Component returns the ids reachable from seeds in either direction, i.e.
+// everything the seeds block or are blocked by, transitively, together with
+// the edges among them.
+func Component(edges []Edge, seeds []int64) ([]int64, []Edge) {
+	adj := map[int64][]int64{}
+	for _, e := range edges {
+		adj[e.TodoID] = append(adj[e.TodoID], e.BlockedBy)
+		adj[e.BlockedBy] = append(adj[e.BlockedBy], e.TodoID)
+	}
+	seen := map[int64]bool{}
+	var ids []int64
+	queue := append([]int64{}, seeds...)
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if seen[cur] {
+			continue
+		}
+		seen[cur] = true
+		ids = append(ids, cur)
+		queue = append(queue, adj[cur]...)
+	}
+	var sub []Edge
+	for _, e := range edges {
+		if seen[e.TodoID] && seen[e.BlockedBy] {
+			sub = append(sub, e)
+		}
+	}
+	return ids, sub
+}
@@ -0,0 +1,36 @@
+package deps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCyclePath(t *testing.T) {
+	// 1 is blocked by 2, 2 by 3.
+	edges := []Edge{{1, 2}, {2, 3}}
+	if p := CyclePath(edges, 1, 4); p != nil {
+		t.Fatalf("unexpected cycle %v", p)
+	}
+	if p := CyclePath(edges, 4, 1); p != nil {
+		t.Fatalf("unexpected cycle %v", p)
+	}
+	// 3 blocked by 1 closes 1 -> 2 -> 3 -> 1.
+	if p := CyclePath(edges, 3, 1); !reflect.DeepEqual(p, []int64{3, 1, 2, 3}) {
+		t.Fatalf("cycle path = %v", p)
+	}
+	if p := CyclePath(edges, 5, 5); !reflect.DeepEqual(p, []int64{5, 5}) {
+		t.Fatalf("self cycle path = %v", p)
+	}
+}
+
+func TestComponent(t *testing.T) {
+	edges := []Edge{{1, 2}, {2, 3}, {4, 5}, {6, 3}}
+	ids, sub := Component(edges, []int64{1})
+	if len(ids) != 4 || len(sub) != 3 {
+		t.Fatalf("component ids=%v edges=%v", ids, sub)
+	}
+	ids, sub = Component(edges, []int64{5})
+	if !reflect.DeepEqual(ids, []int64{5, 4}) || len(sub) != 1 {
+		t.Fatalf("component ids=%v edges=%v", ids, sub)
+	}
+}
@@ -0,0 +1,35 @@
+package etag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of resources with an ETag. The kind is part of the tag so that a
+// todo's tag never satisfies If-Match for the subtask with the same id.
+const (
+	Todo    = "todo"
+	Subtask = "subtask"
+)
+
+// Format builds the strong ETag for version of the resource of kind with id.
+func Format(kind string, id, version int64) string {
+	return fmt.Sprintf(`"%s-%d-%d"`, kind, id, version)
+}
+
+// Match reports whether an If-Match header value matches tag. An empty header
+// means the client did not ask for a precondition and always matches; "*"
+// matches any existing resource. Weak tags never match, as RFC 9110 requires
+// strong comparison for If-Match.
+func Match(header, tag string) bool {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimSpace(candidate) == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package etag
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tag := Format(Todo, 7, 3)
+	if tag != `"todo-7-3"` {
+		t.Fatalf("unexpected tag %s", tag)
+	}
+	cases := map[string]bool{
+		"":                       true,
+		"*":                      true,
+		`"todo-7-3"`:             true,
+		`"todo-7-2", "todo-7-3"`: true,
+		`"todo-7-2"`:             false,
+		`W/"todo-7-3"`:           false,
+		`"todo-8-3"`:             false,
+		` "todo-7-3" `:           true,
+		`"todo-7-2","todo-8-3"`:  false,
+		`"subtask-7-3"`:          false,
+		`"7-3"`:                  false,
+	}
+	for header, want := range cases {
+		if got := Match(header, tag); got != want {
+			t.Fatalf("Match(%q) = %t, want %t", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package fields
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/db"
+)
+
+// Field types.
+const (
+	Text     = "text"
+	Number   = "number"
+	Date     = "date"
+	Select   = "select"
+	Checkbox = "checkbox"
+)
+
+// MaxTextLength is the longest text value accepted, in characters.
+const MaxTextLength = 1000
+
+// Field is a custom field defined by a user for one group. Values live in
+// todos.custom_fields keyed by Key.
+type Field struct {
+	ID        int64     `json:"id"`
+	GroupID   string    `json:"groupId"`
+	Key       string    `json:"key"`
+	Label     string    `json:"label"`
+	Type      string    `json:"type"`
+	Options   []string  `json:"options,omitempty"`
+	Required  bool      `json:"required"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// ValidKey reports whether k can name a field: lower case letters, digits
+// and underscores, starting with a letter.
+func ValidKey(k string) bool {
+	return keyPattern.MatchString(k)
+}
+
+// Validate checks a field definition.
+func (f Field) Validate() error {
+	if strings.TrimSpace(f.GroupID) == "" {
+		return errors.New("groupId is required")
+	}
+	if !ValidKey(f.Key) {
+		return errors.New("key must start with a letter and use only a-z, 0-9 and _ (at most 40)")
+	}
+	if strings.TrimSpace(f.Label) == "" {
+		return errors.New("label is required")
+	}
+	switch f.Type {
+	case Text, Number, Date, Checkbox:
+		if len(f.Options) > 0 {
+			return errors.New("options are only allowed for select fields")
+		}
+	case Select:
+		if len(f.Options) == 0 {
+			return errors.New("select fields need at least one option")
+		}
+		seen := map[string]bool{}
+		for _, o := range f.Options {
+			if strings.TrimSpace(o) == "" || seen[o] {
+				return errors.New("options must be non-empty and distinct")
+			}
+			seen[o] = true
+		}
+	default:
+		return fmt.Errorf("type must be one of %s, %s, %s, %s, %s", Text, Number, Date, Select, Checkbox)
+	}
+	return nil
+}
+
+// Check validates values against the fields of a group and returns them
+// normalized: numbers as float64, dates as YYYY-MM-DD, checkboxes as bool.
+// A nil value or an empty string counts as unset. Unknown keys and missing
+// required fields are errors.
+func Check(defs []Field, values map[string]interface{}) (map[string]interface{}, error) {
+	byKey := make(map[string]Field, len(defs))
+	for _, f := range defs {
+		byKey[f.Key] = f
+	}
+	out := map[string]interface{}{}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f, ok := byKey[k]
+		if !ok {
+			return nil, fmt.Errorf("customFields.%s: no such field in this group", k)
+		}
+		v, err := normalize(f, values[k])
+		if err != nil {
+			return nil, fmt.Errorf("customFields.%s: %v", k, err)
+		}
+		if v != nil {
+			out[k] = v
+		}
+	}
+	for _, f := range defs {
+		if _, ok := out[f.Key]; f.Required && !ok {
+			return nil, fmt.Errorf("customFields.%s is required", f.Key)
+		}
+	}
+	return out, nil
+}
+
+func normalize(f Field, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if s, ok := v.(string); ok && strings.TrimSpace(s) == "" && f.Type != Checkbox {
+		return nil, nil
+	}
+	switch f.Type {
+	case Text:
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("must be a string")
+		}
+		if utf8.RuneCountInString(s) > MaxTextLength {
+			return nil, fmt.Errorf("must be at most %d characters", MaxTextLength)
+		}
+		return s, nil
+	case Number:
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case string:
+			x, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+			if err != nil || math.IsInf(x, 0) || math.IsNaN(x) {
+				return nil, errors.New("must be a number")
+			}
+			return x, nil
+		}
+		return nil, errors.New("must be a number")
+	case Date:
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("must be a date (YYYY-MM-DD)")
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return nil, errors.New("must be a date (YYYY-MM-DD)")
+		}
+		return s, nil
+	case Select:
+		s, ok := v.(string)
+		if ok {
+			for _, o := range f.Options {
+				if o == s {
+					return s, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("must be one of %s", strings.Join(f.Options, ", "))
+	case Checkbox:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, errors.New("must be true or false")
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unknown field type %q", f.Type)
+}
+
+// Filter is a condition on a custom field taken from the query string:
+// cf.<key>=v for equality, cf.<key>.gte=v and cf.<key>.lte=v for ranges.
+type Filter struct {
+	Key   string
+	Op    string // "eq", "gte", "lte", "gt" or "lt"
+	Value string
+}
+
+// ParseFilters collects the cf.* parameters of q, sorted by key.
+func ParseFilters(q url.Values) ([]Filter, error) {
+	var list []Filter
+	for name, vals := range q {
+		rest, ok := strings.CutPrefix(name, "cf.")
+		if !ok {
+			continue
+		}
+		key, op := rest, "eq"
+		if i := strings.LastIndexByte(rest, '.'); i >= 0 {
+			key, op = rest[:i], rest[i+1:]
+			if op != "gte" && op != "lte" {
+				return nil, fmt.Errorf("%s: operator must be gte or lte", name)
+			}
+		}
+		if !ValidKey(key) {
+			return nil, fmt.Errorf("%s: invalid field key", name)
+		}
+		for _, v := range vals {
+			list = append(list, Filter{Key: key, Op: op, Value: v})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Key != list[j].Key {
+			return list[i].Key < list[j].Key
+		}
+		return list[i].Op < list[j].Op
+	})
+	return list, nil
+}
+
+var comparisons = map[string]string{"gte": ">=", "lte": "<=", "gt": ">", "lt": "<"}
+
+// SQL returns the condition on todos for f, using placeholders $n and $n+1
+// for the returned args. Ranges compare numerically when the value is a
+// number and as text otherwise, which orders YYYY-MM-DD dates correctly.
+func (f Filter) SQL(n int) (string, []interface{}) {
+	args := []interface{}{f.Key, f.Value}
+	if f.Op == "eq" {
+		return fmt.Sprintf("custom_fields->>$%d = $%d", n, n+1), args
+	}
+	cmp := comparisons[f.Op]
+	if x, err := strconv.ParseFloat(f.Value, 64); err == nil {
+		args[1] = x
+		return fmt.Sprintf("CASE WHEN jsonb_typeof(custom_fields->$%[1]d)='number' THEN (custom_fields->>$%[1]d)::numeric %[3]s $%[2]d::numeric ELSE false END", n, n+1, cmp), args
+	}
+	return fmt.Sprintf("custom_fields->>$%d %s $%d", n, cmp, n+1), args
+}
+
+const columns = "id,group_id,key,label,type,options,required,position,created_at"
+
+// List returns all of the user's fields, ordered by group and position.
+func List(ctx context.Context, q db.Querier, userID int64) ([]Field, error) {
+	return query(ctx, q, "user_id=$1", userID)
+}
+
+// ForGroup returns the fields of one group in display order.
+func ForGroup(ctx context.Context, q db.Querier, userID int64, groupID string) ([]Field, error) {
+	return query(ctx, q, "user_id=$1 AND group_id=$2", userID, groupID)
+}
+
+// Get returns one field. It returns pgx.ErrNoRows when the user has no field
+// with that id.
+func Get(ctx context.Context, q db.Querier, userID, id int64) (Field, error) {
+	list, err := query(ctx, q, "user_id=$1 AND id=$2", userID, id)
+	if err != nil {
+		return Field{}, err
+	}
+	if len(list) == 0 {
+		return Field{}, pgx.ErrNoRows
+	}
+	return list[0], nil
+}
+
+func query(ctx context.Context, q db.Querier, where string, args ...any) ([]Field, error) {
+	rows, err := q.Query(ctx, "SELECT "+columns+" FROM custom_fields WHERE "+where+" ORDER BY group_id, position, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Field{}
+	for rows.Next() {
+		var f Field
+		if err := rows.Scan(&f.ID, &f.GroupID, &f.Key, &f.Label, &f.Type, &f.Options, &f.Required, &f.Position, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, f)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,109 @@
+package fields
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var defs = []Field{
+	{GroupID: "work", Key: "ticket", Label: "Ticket", Type: Text, Required: true},
+	{GroupID: "work", Key: "points", Label: "Points", Type: Number},
+	{GroupID: "work", Key: "due_review", Label: "Review", Type: Date},
+	{GroupID: "work", Key: "priority", Label: "Priority", Type: Select, Options: []string{"low", "high"}},
+	{GroupID: "work", Key: "billable", Label: "Billable", Type: Checkbox},
+}
+
+func TestCheck(t *testing.T) {
+	got, err := Check(defs, map[string]interface{}{
+		"ticket":     "OPS-12",
+		"points":     "3.5",
+		"due_review": "2025-04-01",
+		"priority":   "high",
+		"billable":   false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"ticket": "OPS-12", "points": 3.5, "due_review": "2025-04-01", "priority": "high", "billable": false}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Check = %v", got)
+	}
+	// Empty values are dropped rather than stored.
+	got, err = Check(defs, map[string]interface{}{"ticket": "A-1", "points": nil, "priority": ""})
+	if err != nil || len(got) != 1 {
+		t.Fatalf("Check with blanks = %v, %v", got, err)
+	}
+
+	bad := []struct {
+		values map[string]interface{}
+		msg    string
+	}{
+		{map[string]interface{}{}, "ticket is required"},
+		{map[string]interface{}{"ticket": "x", "owner": "me"}, "no such field"},
+		{map[string]interface{}{"ticket": "x", "points": "many"}, "must be a number"},
+		{map[string]interface{}{"ticket": "x", "due_review": "01/04/2025"}, "must be a date"},
+		{map[string]interface{}{"ticket": "x", "priority": "urgent"}, "must be one of low, high"},
+		{map[string]interface{}{"ticket": "x", "billable": "yes"}, "true or false"},
+		{map[string]interface{}{"ticket": 12}, "must be a string"},
+		{map[string]interface{}{"ticket": strings.Repeat("x", MaxTextLength+1)}, "at most"},
+	}
+	for _, c := range bad {
+		if _, err := Check(defs, c.values); err == nil || !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("Check(%v) = %v, want %q", c.values, err, c.msg)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, f := range defs {
+		if err := f.Validate(); err != nil {
+			t.Errorf("%s: %v", f.Key, err)
+		}
+	}
+	bad := []Field{
+		{GroupID: "work", Key: "Ticket", Label: "x", Type: Text},
+		{GroupID: "work", Key: "a-b", Label: "x", Type: Text},
+		{GroupID: "", Key: "a", Label: "x", Type: Text},
+		{GroupID: "work", Key: "a", Label: " ", Type: Text},
+		{GroupID: "work", Key: "a", Label: "x", Type: "color"},
+		{GroupID: "work", Key: "a", Label: "x", Type: Select},
+		{GroupID: "work", Key: "a", Label: "x", Type: Select, Options: []string{"a", "a"}},
+		{GroupID: "work", Key: "a", Label: "x", Type: Number, Options: []string{"1"}},
+	}
+	for _, f := range bad {
+		if err := f.Validate(); err == nil {
+			t.Errorf("expected error for %+v", f)
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	q := url.Values{"cf.ticket": {"OPS-12"}, "cf.points.gte": {"3"}, "cf.due_review.lte": {"2025-04-30"}, "date": {"2025-04-01"}}
+	list, err := ParseFilters(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Filter{{"due_review", "lte", "2025-04-30"}, {"points", "gte", "3"}, {"ticket", "eq", "OPS-12"}}
+	if !reflect.DeepEqual(list, want) {
+		t.Fatalf("ParseFilters = %v", list)
+	}
+	cond, args := list[0].SQL(4)
+	if cond != "custom_fields->>$4 <= $5" || args[0] != "due_review" || args[1] != "2025-04-30" {
+		t.Errorf("date range = %s %v", cond, args)
+	}
+	cond, args = list[1].SQL(2)
+	if !strings.Contains(cond, "::numeric >= $3::numeric") || args[1] != 3.0 {
+		t.Errorf("number range = %s %v", cond, args)
+	}
+	cond, _ = list[2].SQL(2)
+	if cond != "custom_fields->>$2 = $3" {
+		t.Errorf("eq = %s", cond)
+	}
+	for _, name := range []string{"cf.points.gt", "cf.Bad", "cf.x;drop"} {
+		if _, err := ParseFilters(url.Values{name: {"1"}}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/page"
+	"chronos-task-manager/pkg/todos"
+)
+
+const (
+	EntityTodo    = "todo"
+	EntitySubtask = "subtask"
+
+	ActionCreate     = "create"
+	ActionUpdate     = "update"
+	ActionComplete   = "complete"
+	ActionUncomplete = "uncomplete"
+	ActionDelete     = "delete"
+	ActionRestore    = "restore"
+	ActionUndo       = "undo"
+)
+
+// Columns written back when a change is undone. Everything else in a
+// snapshot (id, user_id, created_at, ...) is informational only. The current
+// row is the base record, so columns missing from older snapshots are kept.
+const (
+	todoColumns    = "title,description,date,deadline,defer_until,time,group_id,project_id,estimate_minutes,completed,completed_at,tags,custom_fields,rollover_count,rolled_over_to,deleted_at"
+	subtaskColumns = "parent_id,position,title,completed,completed_at,deleted_at"
+)
+
+// todoValues selects todoColumns from a snapshot record r. A project or todo
+// referenced by the snapshot may have been deleted since; the reference is
+// dropped then, as ON DELETE SET NULL did for the live row.
+const todoValues = "r.title,r.description,r.date,r.deadline,r.defer_until,r.time,r.group_id," +
+	"(SELECT p.id FROM projects p WHERE p.id=r.project_id AND p.user_id=$3)," +
+	"r.estimate_minutes,r.completed,r.completed_at,r.tags,r.custom_fields,r.rollover_count," +
+	"(SELECT o.id FROM todos o WHERE o.id=r.rolled_over_to AND o.user_id=$3)," +
+	"r.deleted_at"
+
+// Entry is one row of todo_history. Before is null for creates; After is the
+// row as it looked once the change was applied. Entries written by the same
+// transaction, such as a todo and the subtasks saved with it, share a
+// BatchID and are undone together.
+type Entry struct {
+	ID        int64           `json:"id"`
+	BatchID   *int64          `json:"batchId,omitempty"`
+	TodoID    int64           `json:"todoId"`
+	SubtaskID *int64          `json:"subtaskId,omitempty"`
+	Entity    string          `json:"entity"`
+	Action    string          `json:"action"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	ActorID   int64           `json:"actorId"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UndoneAt  *time.Time      `json:"undoneAt,omitempty"`
+}
+
+// ErrNothingToUndo is returned by Undo when the user has no undoable changes.
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// SnapshotTodo returns the todo row as JSON. It returns pgx.ErrNoRows when
+// the todo does not exist or belongs to another user.
+func SnapshotTodo(ctx context.Context, q db.Querier, userID, id int64) (json.RawMessage, error) {
+	var snap json.RawMessage
+	err := q.QueryRow(ctx, "SELECT to_jsonb(t) - 'user_id' FROM todos t WHERE id=$1 AND user_id=$2", id, userID).Scan(&snap)
+	return snap, err
+}
+
+// SnapshotSubtask returns the subtask row as JSON together with its todo id.
+func SnapshotSubtask(ctx context.Context, q db.Querier, userID, id int64) (json.RawMessage, int64, error) {
+	var snap json.RawMessage
+	var todoID int64
+	err := q.QueryRow(ctx, "SELECT to_jsonb(s), s.todo_id FROM subtasks s JOIN todos t ON t.id=s.todo_id WHERE s.id=$1 AND t.user_id=$2", id, userID).Scan(&snap, &todoID)
+	return snap, todoID, err
+}
+
+// Record appends e to the history of userID's todo, in the batch of the
+// current transaction.
+func Record(ctx context.Context, q db.Querier, userID int64, e Entry) error {
+	_, err := q.Exec(ctx, "INSERT INTO todo_history(user_id,actor_id,todo_id,subtask_id,entity,action,before,after,batch_id) VALUES($1,$2,$3,$4,$5,$6,$7,$8,txid_current())",
+		userID, e.ActorID, e.TodoID, e.SubtaskID, e.Entity, e.Action, nullJSON(e.Before), nullJSON(e.After))
+	return err
+}
+
+// Timeline returns one page of the history of a todo and its subtasks,
+// newest first.
+func Timeline(ctx context.Context, q db.Querier, userID, todoID int64, req page.Request) ([]Entry, page.Info, error) {
+	var info page.Info
+	if req.Total {
+		var n int64
+		if err := q.QueryRow(ctx, "SELECT COUNT(*) FROM todo_history WHERE user_id=$1 AND todo_id=$2", userID, todoID).Scan(&n); err != nil {
+			return nil, info, err
+		}
+		info.Total = &n
+	}
+	sql := "SELECT id,batch_id,todo_id,subtask_id,entity,action,before,after,actor_id,created_at,undone_at FROM todo_history WHERE user_id=$1 AND todo_id=$2"
+	args := []any{userID, todoID}
+	order := "DESC"
+	if req.Cursor != nil {
+		args = append(args, req.Cursor.ID)
+		if req.Backward() {
+			sql += " AND id>$3"
+			order = "ASC"
+		} else {
+			sql += " AND id<$3"
+		}
+	}
+	entries, err := query(ctx, q, fmt.Sprintf("%s ORDER BY id %s LIMIT %d", sql, order, req.Limit+1), args...)
+	if err != nil {
+		return nil, info, err
+	}
+	entries, pi := page.Trim(entries, req, func(e Entry) page.Cursor { return page.Cursor{ID: e.ID} })
+	pi.Total = info.Total
+	return entries, pi, nil
+}
+
+// Undo reverts the user's most recent changes that have not been undone yet,
+// newest first. A step is one batch, so all changes a request made are
+// reverted together; entries recorded before batches existed are a step each.
+// When todoID is non-zero only changes to that todo count. Undoing a create
+// moves the item to the trash; everything else restores the snapshot taken
+// before the change. It should run inside a transaction.
+func Undo(ctx context.Context, q db.Querier, userID, actorID int64, steps int, todoID int64) ([]Entry, error) {
+	if steps < 1 {
+		steps = 1
+	}
+	const undoable = "user_id=$1 AND undone_at IS NULL AND action<>'undo' AND ($2=0 OR todo_id=$2)"
+	sql := "SELECT id,batch_id,todo_id,subtask_id,entity,action,before,after,actor_id,created_at,undone_at FROM todo_history WHERE " + undoable +
+		" AND COALESCE(batch_id, -id) IN (SELECT COALESCE(batch_id, -id) FROM todo_history WHERE " + undoable + " GROUP BY 1 ORDER BY MAX(id) DESC LIMIT $3)" +
+		" ORDER BY id DESC FOR UPDATE"
+	entries, err := query(ctx, q, sql, userID, todoID, steps)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrNothingToUndo
+	}
+	for i := range entries {
+		if err := revert(ctx, q, userID, actorID, entries[i]); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		if _, err := q.Exec(ctx, "UPDATE todo_history SET undone_at=$1 WHERE id=$2", now, entries[i].ID); err != nil {
+			return nil, err
+		}
+		entries[i].UndoneAt = &now
+	}
+	return entries, nil
+}
+
+func revert(ctx context.Context, q db.Querier, userID, actorID int64, e Entry) error {
+	undo := Entry{TodoID: e.TodoID, SubtaskID: e.SubtaskID, Entity: e.Entity, Action: ActionUndo, ActorID: actorID}
+	var err error
+	if e.Entity == EntitySubtask {
+		if e.SubtaskID == nil {
+			return nil
+		}
+		sid := *e.SubtaskID
+		if undo.Before, _, err = SnapshotSubtask(ctx, q, userID, sid); errors.Is(err, pgx.ErrNoRows) {
+			// Permanently deleted since; there is nothing left to revert.
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if e.Before == nil {
+			_, err = todos.TrashSubtask(ctx, q, sid, time.Now())
+		} else {
+			err = revertSubtask(ctx, q, sid, e.Before)
+		}
+		if err != nil {
+			return err
+		}
+		if undo.After, _, err = SnapshotSubtask(ctx, q, userID, sid); err != nil {
+			return err
+		}
+		return Record(ctx, q, userID, undo)
+	}
+	if undo.Before, err = SnapshotTodo(ctx, q, userID, e.TodoID); errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if e.Before == nil {
+		_, err = q.Exec(ctx, "UPDATE todos SET deleted_at=NOW() WHERE id=$1 AND user_id=$2", e.TodoID, userID)
+	} else {
+		_, err = q.Exec(ctx, "UPDATE todos t SET ("+todoColumns+") = (SELECT "+todoValues+" FROM jsonb_populate_record(t, $1) r) WHERE id=$2 AND user_id=$3", []byte(e.Before), e.TodoID, userID)
+	}
+	if err != nil {
+		return err
+	}
+	if undo.After, err = SnapshotTodo(ctx, q, userID, e.TodoID); err != nil {
+		return err
+	}
+	return Record(ctx, q, userID, undo)
+}
+
+// revertSubtask writes a subtask snapshot back. The branch below the subtask
+// follows it into or out of the trash.
+func revertSubtask(ctx context.Context, q db.Querier, sid int64, before json.RawMessage) error {
+	var snap struct {
+		DeletedAt *time.Time `json:"deleted_at"`
+	}
+	if err := json.Unmarshal(before, &snap); err != nil {
+		return err
+	}
+	if snap.DeletedAt == nil {
+		if _, err := todos.RestoreSubtask(ctx, q, sid); err != nil {
+			return err
+		}
+	}
+	if _, err := q.Exec(ctx, "UPDATE subtasks s SET ("+subtaskColumns+") = (SELECT "+subtaskColumns+" FROM jsonb_populate_record(s, $1)) WHERE id=$2", []byte(before), sid); err != nil {
+		return err
+	}
+	if snap.DeletedAt != nil {
+		_, err := todos.TrashSubtask(ctx, q, sid, *snap.DeletedAt)
+		return err
+	}
+	return nil
+}
+
+func query(ctx context.Context, q db.Querier, sql string, args ...any) ([]Entry, error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Entry{}
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.BatchID, &e.TodoID, &e.SubtaskID, &e.Entity, &e.Action, &e.Before, &e.After, &e.ActorID, &e.CreatedAt, &e.UndoneAt); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+func nullJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return []byte(raw)
+}
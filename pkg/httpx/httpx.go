@@ -0,0 +1,73 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"chronos-task-manager/pkg/auth"
+	"chronos-task-manager/pkg/logx"
+	"chronos-task-manager/pkg/validate"
+)
+
+// JSON writes v as the response body with the given status code.
+func JSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// OK writes the standard {"ok":true,"data":...} envelope. A nil data omits the field.
+func OK(w http.ResponseWriter, data interface{}) {
+	body := map[string]interface{}{"ok": true}
+	if data != nil {
+		body["data"] = data
+	}
+	JSON(w, http.StatusOK, body)
+}
+
+// Error writes the standard {"ok":false,"error":...} envelope.
+func Error(w http.ResponseWriter, status int, msg string) {
+	JSON(w, status, map[string]interface{}{"ok": false, "error": msg})
+}
+
+// User authenticates the request from its bearer token. On failure it writes
+// a 401 response and returns false.
+func User(w http.ResponseWriter, r *http.Request) (*auth.Claims, bool) {
+	token, err := auth.FromAuthHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return nil, false
+	}
+	c, err := auth.ParseToken(token)
+	if err != nil {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return nil, false
+	}
+	logx.SetUser(r.Context(), c.UserID)
+	return c, true
+}
+
+// ParseID accepts an id decoded from JSON either as a number or a numeric
+// string, which is how the frontend sends it. It returns 0 when v is not an id.
+func ParseID(v interface{}) int64 {
+	switch t := v.(type) {
+	case float64:
+		return int64(t)
+	case string:
+		if parsed, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return parsed
+		}
+	}
+	return 0
+}
+
+// Invalid writes a 422 response listing every invalid field of the input.
+func Invalid(w http.ResponseWriter, errs validate.Errors) {
+	JSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"ok": false, "error": "invalid input", "fields": errs})
+}
+
+// InvalidField writes a 422 response for a single invalid field.
+func InvalidField(w http.ResponseWriter, field, code, msg string) {
+	Invalid(w, validate.Errors{{Field: field, Code: code, Message: msg}})
+}
@@ -0,0 +1,63 @@
+package httpx
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"chronos-task-manager/pkg/logx"
+)
+
+// Serve runs h as one logged request. The request ID comes from
+// X-Request-ID or is generated, and is echoed back in the response header of
+// the same name. Records logged with r.Context() inside h carry it, and once
+// User authenticates the request, the user's id. When h returns, one
+// "request" line records the method, path, status and latency, at error
+// level for 5xx responses.
+func Serve(w http.ResponseWriter, r *http.Request, h http.HandlerFunc) {
+	start := time.Now()
+	req := &logx.Request{ID: logx.RequestID(r.Header.Get("X-Request-ID"))}
+	w.Header().Set("X-Request-ID", req.ID)
+	r = r.WithContext(logx.WithRequest(r.Context(), req))
+	rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+	h(rec, r)
+	level := slog.LevelInfo
+	if rec.status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	slog.Log(r.Context(), level, "request",
+		"method", r.Method,
+		"path", r.URL.Path,
+		"status", rec.status,
+		"bytes", rec.bytes,
+		"latency_ms", float64(time.Since(start).Microseconds())/1000,
+	)
+}
+
+// recorder notes the status and size of the response it passes through.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,32 @@
+package httpx
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// V1 reports whether the request came in through an /api/v1 route. Those are
+// rewrites onto the same handlers as the legacy routes (see vercel.json) that
+// add api=v1 and the path parameters to the query string.
+func V1(r *http.Request) bool {
+	return r.URL.Query().Get("api") == "v1"
+}
+
+// Deprecate marks the response to a legacy route as deprecated and links to
+// the /api/v1 route replacing it. Requests routed as v1 are left alone.
+func Deprecate(w http.ResponseWriter, r *http.Request, successor string) {
+	if V1(r) {
+		return
+	}
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+}
+
+// QueryID returns the id in query parameter key, or 0.
+func QueryID(r *http.Request, key string) int64 {
+	id, err := strconv.ParseInt(r.URL.Query().Get(key), 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
@@ -0,0 +1,123 @@
+// Package logx configures the default log/slog logger for every function.
+// LOG_LEVEL picks the lowest level written (debug, info, warn or error;
+// info by default) and LOG_FORMAT=json switches from text to one JSON object
+// per line. Records logged with a request's context carry its request_id
+// and, once authenticated, its user_id, and every record is passed through
+// Redact before it is written.
+package logx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+func init() {
+	slog.SetDefault(New(os.Stderr, os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL")))
+}
+
+// New returns a logger writing to w in the given format ("json" or text) at
+// the given minimum level.
+func New(w io.Writer, format, level string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: ParseLevel(level), ReplaceAttr: redactAttr}
+	var h slog.Handler
+	if strings.EqualFold(strings.TrimSpace(format), "json") {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+// ParseLevel reads a level name, falling back to info.
+func ParseLevel(s string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// Request is what a request's log records share. UserID stays 0 until the
+// request is authenticated.
+type Request struct {
+	ID     string
+	UserID int64
+}
+
+type requestKey struct{}
+
+// WithRequest returns ctx carrying req.
+func WithRequest(ctx context.Context, req *Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, req)
+}
+
+// FromContext returns the request ctx carries, or nil.
+func FromContext(ctx context.Context) *Request {
+	if ctx == nil {
+		return nil
+	}
+	req, _ := ctx.Value(requestKey{}).(*Request)
+	return req
+}
+
+// SetUser records the authenticated user of the request ctx carries.
+func SetUser(ctx context.Context, userID int64) {
+	if req := FromContext(ctx); req != nil {
+		req.UserID = userID
+	}
+}
+
+// RequestID returns the incoming X-Request-ID when it is a plausible id, so
+// that a caller's or proxy's id can be followed through the logs, and a new
+// random one otherwise.
+func RequestID(incoming string) string {
+	if validRequestID(incoming) {
+		return incoming
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(s string) bool {
+	if s == "" || len(s) > 128 {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("-_.:", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// contextHandler adds the request_id and user_id of the record's context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if req := FromContext(ctx); req != nil {
+		r.AddAttrs(slog.String("request_id", req.ID))
+		if req.UserID != 0 {
+			r.AddAttrs(slog.Int64("user_id", req.UserID))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,66 @@
+package logx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestJSONRecord(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "json", "info")
+	ctx := WithRequest(context.Background(), &Request{ID: "req-1"})
+	SetUser(ctx, 42)
+	logger.DebugContext(ctx, "hidden")
+	logger.ErrorContext(ctx, "insert failed for a@b.io", "err", errors.New("duplicate key (email)=(a@b.io)"), "password", "hunter2")
+
+	var rec map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("want one JSON record, got %q: %v", buf.String(), err)
+	}
+	want := map[string]interface{}{
+		"level":      "ERROR",
+		"msg":        "insert failed for a***@b.io",
+		"err":        "duplicate key (email)=(a***@b.io)",
+		"password":   "[REDACTED]",
+		"request_id": "req-1",
+		"user_id":    42.0,
+	}
+	for k, v := range want {
+		if rec[k] != v {
+			t.Errorf("%s = %v, want %v", k, rec[k], v)
+		}
+	}
+}
+
+func TestTextWithoutRequest(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, "", "debug").With("n", 1).Debug("cold start")
+	out := buf.String()
+	if !strings.Contains(out, "level=DEBUG") || !strings.Contains(out, `msg="cold start" n=1`) || strings.Contains(out, "request_id") {
+		t.Errorf("out = %q", out)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{"": slog.LevelInfo, "debug": slog.LevelDebug, "WARN": slog.LevelWarn, "error": slog.LevelError, "loud": slog.LevelInfo} {
+		if got := ParseLevel(in); got != want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	if got := RequestID("abc-123"); got != "abc-123" {
+		t.Errorf("incoming id not kept: %q", got)
+	}
+	for _, in := range []string{"", "has space", strings.Repeat("x", 129), "a\nb"} {
+		if got := RequestID(in); got == in || len(got) != 32 {
+			t.Errorf("RequestID(%q) = %q, want a new id", in, got)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package page
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+// Cursor is the position of a row in a keyset ordering. Key holds the sort
+// value before the id tie-breaker (empty when ordering by id alone). Backward
+// cursors fetch the page that precedes the row instead of the one after it.
+type Cursor struct {
+	Key      string `json:"k,omitempty"`
+	ID       int64  `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// Request is a page request parsed from the query string.
+type Request struct {
+	Limit  int
+	Cursor *Cursor
+	Total  bool
+}
+
+// Info is returned alongside a page. Cursors are opaque to clients.
+type Info struct {
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+func Encode(c Cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func Decode(s string) (Cursor, error) {
+	var c Cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &c) != nil || c.ID == 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// FromQuery reads limit, cursor and total from v. limit defaults to def and
+// is capped at max.
+func FromQuery(v url.Values, def, max int) (Request, error) {
+	req := Request{Limit: def, Total: v.Get("total") == "1" || v.Get("total") == "true"}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return req, errors.New("invalid limit")
+		}
+		req.Limit = n
+	}
+	if req.Limit > max {
+		req.Limit = max
+	}
+	if s := v.Get("cursor"); s != "" {
+		c, err := Decode(s)
+		if err != nil {
+			return req, err
+		}
+		req.Cursor = &c
+	}
+	return req, nil
+}
+
+// Backward reports whether the request walks towards earlier pages.
+func (r Request) Backward() bool {
+	return r.Cursor != nil && r.Cursor.Backward
+}
+
+// Trim turns rows fetched with LIMIT r.Limit+1 in fetch order (reversed
+// when walking backward) into the page in display order and its cursors.
+func Trim[T any](rows []T, r Request, key func(T) Cursor) ([]T, Info) {
+	more := len(rows) > r.Limit
+	if more {
+		rows = rows[:r.Limit]
+	}
+	back := r.Backward()
+	if back {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	var info Info
+	if len(rows) == 0 {
+		return rows, info
+	}
+	if (back && more) || (!back && r.Cursor != nil) {
+		c := key(rows[0])
+		c.Backward = true
+		info.PrevCursor = Encode(c)
+	}
+	if (!back && more) || (back && r.Cursor != nil) {
+		info.NextCursor = Encode(key(rows[len(rows)-1]))
+	}
+	return rows, info
+}
@@ -0,0 +1,65 @@
+package page
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	in := Cursor{Key: "2025-11-24", ID: 42, Backward: true}
+	out, err := Decode(Encode(in))
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if out != in {
+		t.Fatalf("cursor mismatch: %+v", out)
+	}
+	for _, bad := range []string{"", "!!!", Encode(Cursor{})} {
+		if _, err := Decode(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestFromQuery(t *testing.T) {
+	req, err := FromQuery(url.Values{"limit": {"1000"}, "total": {"1"}}, 50, 200)
+	if err != nil || req.Limit != 200 || !req.Total || req.Cursor != nil {
+		t.Fatalf("unexpected request %+v err=%v", req, err)
+	}
+	if _, err := FromQuery(url.Values{"limit": {"0"}}, 50, 200); err == nil {
+		t.Fatalf("expected error for limit=0")
+	}
+	if _, err := FromQuery(url.Values{"cursor": {"nope"}}, 50, 200); err == nil {
+		t.Fatalf("expected error for bad cursor")
+	}
+}
+
+func TestTrim(t *testing.T) {
+	key := func(id int64) Cursor { return Cursor{ID: id} }
+
+	// First page: one extra row means there is a next page but no previous.
+	rows, info := Trim([]int64{9, 8, 7}, Request{Limit: 2}, key)
+	if len(rows) != 2 || rows[1] != 8 || info.PrevCursor != "" || info.NextCursor == "" {
+		t.Fatalf("first page: rows=%v info=%+v", rows, info)
+	}
+	next, _ := Decode(info.NextCursor)
+	if next.ID != 8 || next.Backward {
+		t.Fatalf("next cursor: %+v", next)
+	}
+
+	// Last page reached going forward: previous page only.
+	rows, info = Trim([]int64{7}, Request{Limit: 2, Cursor: &next}, key)
+	if len(rows) != 1 || info.NextCursor != "" || info.PrevCursor == "" {
+		t.Fatalf("last page: rows=%v info=%+v", rows, info)
+	}
+	prev, _ := Decode(info.PrevCursor)
+	if prev.ID != 7 || !prev.Backward {
+		t.Fatalf("prev cursor: %+v", prev)
+	}
+
+	// Walking backward fetches in reverse order; rows come back in display order.
+	rows, info = Trim([]int64{8, 9}, Request{Limit: 2, Cursor: &prev}, key)
+	if len(rows) != 2 || rows[0] != 9 || rows[1] != 8 || info.PrevCursor != "" || info.NextCursor == "" {
+		t.Fatalf("backward page: rows=%v info=%+v", rows, info)
+	}
+}
@@ -0,0 +1,296 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Op is one operation of an RFC 6902 JSON Patch.
+type Op struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ErrTestFailed is returned by Apply when a test operation does not match.
+var ErrTestFailed = errors.New("test operation failed")
+
+// OpError reports the operation of a patch that could not be applied.
+type OpError struct {
+	Index int
+	Msg   string
+	Err   error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("patch operation %d: %s", e.Index, e.Msg)
+}
+
+func (e *OpError) Unwrap() error { return e.Err }
+
+// ToMerge turns ops into the merge patch that has the same effect on doc, the
+// current document of a resource, so that a JSON Patch can go through the
+// same checks as a merge patch. Errors map to responses through Status.
+func ToMerge(doc map[string]interface{}, ops []Op) (map[string]json.RawMessage, error) {
+	next, err := Apply(doc, ops)
+	if err != nil {
+		return nil, err
+	}
+	return Raw(Diff(doc, next))
+}
+
+// Status returns the HTTP status and client message for an error of
+// ToMerge: 409 when a test operation failed, 400 for an operation that
+// could not be applied and 500 otherwise.
+func Status(err error) (int, string) {
+	var opErr *OpError
+	switch {
+	case errors.Is(err, ErrTestFailed):
+		return http.StatusConflict, err.Error()
+	case errors.As(err, &opErr):
+		return http.StatusBadRequest, err.Error()
+	}
+	return http.StatusInternalServerError, "db error"
+}
+
+// Apply runs ops against a copy of doc in order and returns the result. The
+// patch is atomic: on error doc is left as it was and nothing is returned.
+func Apply(doc map[string]interface{}, ops []Op) (map[string]interface{}, error) {
+	var root interface{} = clone(doc)
+	for i, op := range ops {
+		var err error
+		if root, err = applyOp(root, op); err != nil {
+			var oe *OpError
+			if errors.As(err, &oe) {
+				oe.Index = i
+				return nil, oe
+			}
+			return nil, &OpError{Index: i, Msg: err.Error(), Err: err}
+		}
+	}
+	out, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, &OpError{Index: len(ops) - 1, Msg: "the document must remain an object"}
+	}
+	return out, nil
+}
+
+func applyOp(root interface{}, op Op) (interface{}, error) {
+	path, err := pointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	value := func() (interface{}, error) {
+		if len(op.Value) == 0 {
+			return nil, errors.New("missing value")
+		}
+		var v interface{}
+		if err := json.Unmarshal(op.Value, &v); err != nil {
+			return nil, errors.New("invalid value")
+		}
+		return v, nil
+	}
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return add(root, path, v)
+	case "remove":
+		root, _, err := remove(root, path)
+		return root, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		if root, _, err = remove(root, path); err != nil {
+			return nil, err
+		}
+		return add(root, path, v)
+	case "move", "copy":
+		from, err := pointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" && strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+			return nil, errors.New("cannot move a value into itself")
+		}
+		v, err := get(root, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if root, _, err = remove(root, from); err != nil {
+				return nil, err
+			}
+		} else {
+			v = clone(v)
+		}
+		return add(root, path, v)
+	case "test":
+		want, err := value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := get(root, path)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			return nil, &OpError{Msg: "value at " + op.Path + " does not match", Err: ErrTestFailed}
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// pointer splits an RFC 6901 JSON Pointer into unescaped tokens.
+func pointer(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("invalid path %q", s)
+	}
+	parts := strings.Split(s[1:], "/")
+	for i, p := range parts {
+		parts[i] = strings.ReplaceAll(strings.ReplaceAll(p, "~1", "/"), "~0", "~")
+	}
+	return parts, nil
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, tok := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[tok]
+			if !ok {
+				return nil, fmt.Errorf("path member %q not found", tok)
+			}
+			node = v
+		case []interface{}:
+			i, err := index(tok, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("path member %q not found", tok)
+		}
+	}
+	return node, nil
+}
+
+// add sets the value at path, inserting into arrays, and returns the new root.
+func add(root interface{}, path []string, v interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[last] = v
+		return root, nil
+	case []interface{}:
+		i := len(p)
+		if last != "-" {
+			if i, err = index(last, len(p)); err != nil {
+				return nil, err
+			}
+		}
+		next := append(p[:i:i], append([]interface{}{v}, p[i:]...)...)
+		return replaceAt(root, path[:len(path)-1], next)
+	}
+	return nil, fmt.Errorf("cannot add to %q", last)
+}
+
+// remove deletes the value at path and returns the new root and the value.
+func remove(root interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		v, ok := p[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("path member %q not found", last)
+		}
+		delete(p, last)
+		return root, v, nil
+	case []interface{}:
+		i, err := index(last, len(p)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := p[i]
+		next := append(p[:i:i], p[i+1:]...)
+		root, err = replaceAt(root, path[:len(path)-1], next)
+		return root, v, err
+	}
+	return nil, nil, fmt.Errorf("path member %q not found", last)
+}
+
+// replaceAt swaps the array at path for next, since growing or shrinking a
+// slice gives a new slice header that its parent has to hold.
+func replaceAt(root interface{}, path []string, next []interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return next, nil
+	}
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[last] = next
+	case []interface{}:
+		i, err := index(last, len(p)-1)
+		if err != nil {
+			return nil, err
+		}
+		p[i] = next
+	}
+	return root, nil
+}
+
+// index parses an array index no greater than max.
+func index(tok string, max int) (int, error) {
+	i, err := strconv.Atoi(tok)
+	if err != nil || i < 0 || i > max || (len(tok) > 1 && tok[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	return i, nil
+}
+
+func clone(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			out[k] = clone(e)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, e := range t {
+			out[i] = clone(e)
+		}
+		return out
+	}
+	return v
+}
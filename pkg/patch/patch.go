@@ -0,0 +1,204 @@
+// Package patch decodes partial updates. A request body is read as an RFC 7396
+// merge patch, where a missing member leaves a field unchanged and null clears
+// it; RFC 6902 JSON Patch documents are turned into the same form by applying
+// them to the current resource and diffing the result (see Apply and Diff).
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+
+	"chronos-task-manager/pkg/validate"
+)
+
+// Media types of the two patch formats.
+const (
+	MergePatch = "application/merge-patch+json"
+	JSONPatch  = "application/json-patch+json"
+)
+
+// MediaType returns the media type of the request body without parameters.
+func MediaType(r *http.Request) string {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+// Body is a patch request body: a merge patch in Doc, or the operations of a
+// JSON Patch in Ops when Ops is not nil.
+type Body struct {
+	Doc map[string]json.RawMessage
+	Ops []Op
+}
+
+// ReadBody decodes a request body sent as a merge patch or a JSON Patch,
+// chosen by its Content-Type. ok is false for any other media type, and the
+// body is then left unread; err reports malformed JSON.
+func ReadBody(r *http.Request) (b Body, ok bool, err error) {
+	switch MediaType(r) {
+	case MergePatch:
+		err = json.NewDecoder(r.Body).Decode(&b.Doc)
+	case JSONPatch:
+		if err = json.NewDecoder(r.Body).Decode(&b.Ops); err == nil && b.Ops == nil {
+			b.Ops = []Op{}
+		}
+	default:
+		return b, false, nil
+	}
+	return b, true, err
+}
+
+// Field is one member of a merge patch. Set reports whether the member was
+// present and Null whether it was null; Value holds the decoded value
+// otherwise.
+type Field[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+// UnmarshalJSON is only called for members that are present.
+func (f *Field[T]) UnmarshalJSON(b []byte) error {
+	f.Set = true
+	if bytes.Equal(bytes.TrimSpace(b), []byte("null")) {
+		f.Null = true
+		return nil
+	}
+	return json.Unmarshal(b, &f.Value)
+}
+
+// Ptr returns the value, or nil when the member was null or absent.
+func (f Field[T]) Ptr() *T {
+	if !f.Set || f.Null {
+		return nil
+	}
+	v := f.Value
+	return &v
+}
+
+// Decode reads the members of doc into dst, which maps member names to
+// pointers to Field values. Members missing from dst and values of the wrong
+// type are reported per field rather than stopping at the first one.
+func Decode(doc map[string]json.RawMessage, dst map[string]interface{}) validate.Errors {
+	var errs validate.Errors
+	for name, raw := range doc {
+		target, ok := dst[name]
+		if !ok {
+			errs.Add(name, validate.CodeUnknownField, "unknown field")
+			continue
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			errs.Add(name, validate.CodeType, typeMessage(err))
+		}
+	}
+	return errs
+}
+
+func typeMessage(err error) string {
+	var te *json.UnmarshalTypeError
+	if !errors.As(err, &te) {
+		return "invalid value"
+	}
+	if te.Field != "" {
+		return fmt.Sprintf("%s must be %s", te.Field, expected(te.Type))
+	}
+	return "must be " + expected(te.Type)
+}
+
+func expected(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
+
+// Merge applies an RFC 7396 merge patch to target and returns the result.
+// Objects are merged member by member, null removes a member and any other
+// value replaces it. target is not modified.
+func Merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	out := map[string]interface{}{}
+	if ok {
+		for k, v := range t {
+			out[k] = v
+		}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		out[k] = Merge(out[k], v)
+	}
+	return out
+}
+
+// Diff returns the merge patch that turns a into b: members of b that differ
+// from a, nested objects diffed recursively, and null for members of a that
+// b lacks.
+func Diff(a, b map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			out[k] = nil
+		}
+	}
+	for k, bv := range b {
+		av, ok := a[k]
+		if ok && reflect.DeepEqual(av, bv) {
+			continue
+		}
+		am, aObj := av.(map[string]interface{})
+		bm, bObj := bv.(map[string]interface{})
+		if ok && aObj && bObj {
+			out[k] = Diff(am, bm)
+			continue
+		}
+		out[k] = bv
+	}
+	return out
+}
+
+// Document converts v to its generic JSON form.
+func Document(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	return doc, json.Unmarshal(b, &doc)
+}
+
+// Raw splits a generic JSON object into raw members for Decode.
+func Raw(doc map[string]interface{}) (map[string]json.RawMessage, error) {
+	out := make(map[string]json.RawMessage, len(doc))
+	for k, v := range doc {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = b
+	}
+	return out, nil
+}
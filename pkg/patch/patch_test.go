@@ -0,0 +1,182 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"chronos-task-manager/pkg/validate"
+)
+
+func TestDecode(t *testing.T) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(`{"title":"a","time":null,"estimate":"x","extra":1}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var title, tm, date Field[string]
+	var estimate Field[int]
+	errs := Decode(doc, map[string]interface{}{"title": &title, "time": &tm, "date": &date, "estimate": &estimate})
+	if !title.Set || title.Null || title.Value != "a" {
+		t.Errorf("title = %+v", title)
+	}
+	if !tm.Set || !tm.Null || tm.Ptr() != nil {
+		t.Errorf("time = %+v", tm)
+	}
+	if date.Set {
+		t.Errorf("date should be absent: %+v", date)
+	}
+	err := errs.Err()
+	want := validate.Errors{
+		{Field: "estimate", Code: validate.CodeType, Message: "must be an integer"},
+		{Field: "extra", Code: validate.CodeUnknownField, Message: "unknown field"},
+	}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("errors = %#v, want %#v", err, want)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	target := map[string]interface{}{"a": "b", "c": map[string]interface{}{"d": "e", "f": "g"}}
+	patch := map[string]interface{}{"a": "z", "c": map[string]interface{}{"f": nil}}
+	got := Merge(target, patch)
+	want := map[string]interface{}{"a": "z", "c": map[string]interface{}{"d": "e"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge = %v, want %v", got, want)
+	}
+	if target["a"] != "b" {
+		t.Error("Merge modified target")
+	}
+	if got := Merge(target, []interface{}{1.0}); !reflect.DeepEqual(got, []interface{}{1.0}) {
+		t.Errorf("non-object patch = %v", got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := map[string]interface{}{"title": "a", "time": "10:00", "tags": []interface{}{"x"}, "cf": map[string]interface{}{"k": 1.0, "j": 2.0}}
+	b := map[string]interface{}{"title": "a", "tags": []interface{}{"x", "y"}, "cf": map[string]interface{}{"k": 1.0}}
+	got := Diff(a, b)
+	want := map[string]interface{}{"time": nil, "tags": []interface{}{"x", "y"}, "cf": map[string]interface{}{"j": nil}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(Merge(a, got), b) {
+		t.Errorf("Merge(a, Diff(a, b)) = %v, want %v", Merge(a, got), b)
+	}
+}
+
+func TestApply(t *testing.T) {
+	doc := map[string]interface{}{"title": "a", "time": "10:00", "tags": []interface{}{"x", "y"}, "cf": map[string]interface{}{}}
+	var ops []Op
+	err := json.Unmarshal([]byte(`[
+		{"op":"test","path":"/title","value":"a"},
+		{"op":"replace","path":"/title","value":"b"},
+		{"op":"remove","path":"/time"},
+		{"op":"add","path":"/tags/1","value":"w"},
+		{"op":"add","path":"/tags/-","value":"z"},
+		{"op":"remove","path":"/tags/0"},
+		{"op":"add","path":"/cf/a~1b","value":1},
+		{"op":"copy","from":"/title","path":"/cf/t"},
+		{"op":"move","from":"/cf/t","path":"/description"}
+	]`), &ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Apply(doc, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"title": "b", "description": "b", "tags": []interface{}{"w", "y", "z"}, "cf": map[string]interface{}{"a/b": 1.0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply = %v, want %v", got, want)
+	}
+	if doc["title"] != "a" || len(doc["tags"].([]interface{})) != 2 {
+		t.Errorf("Apply modified doc: %v", doc)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	doc := map[string]interface{}{"title": "a", "tags": []interface{}{"x"}}
+	cases := []struct {
+		ops   string
+		index int
+		test  bool
+	}{
+		{`[{"op":"test","path":"/title","value":"b"}]`, 0, true},
+		{`[{"op":"replace","path":"/title","value":"b"},{"op":"remove","path":"/missing"}]`, 1, false},
+		{`[{"op":"add","path":"/tags/2","value":"z"}]`, 0, false},
+		{`[{"op":"remove","path":"/tags/01"}]`, 0, false},
+		{`[{"op":"add","path":"title","value":"z"}]`, 0, false},
+		{`[{"op":"add","path":"/title"}]`, 0, false},
+		{`[{"op":"frob","path":"/title"}]`, 0, false},
+		{`[{"op":"move","from":"/tags","path":"/tags/0"}]`, 0, false},
+	}
+	for _, c := range cases {
+		var ops []Op
+		if err := json.Unmarshal([]byte(c.ops), &ops); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Apply(doc, ops)
+		var oe *OpError
+		if !errors.As(err, &oe) || oe.Index != c.index {
+			t.Errorf("Apply(%s) error = %v, want op %d", c.ops, err, c.index)
+			continue
+		}
+		if errors.Is(err, ErrTestFailed) != c.test {
+			t.Errorf("Apply(%s) test failure = %v", c.ops, !c.test)
+		}
+	}
+	if doc["title"] != "a" {
+		t.Errorf("failed patch modified doc: %v", doc)
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	cases := []struct {
+		contentType, body string
+		ok, ops, err      bool
+	}{
+		{"application/merge-patch+json", `{"title":"a"}`, true, false, false},
+		{"application/json-patch+json; charset=utf-8", `null`, true, true, false},
+		{"application/json-patch+json", `{`, true, false, true},
+		{"application/json", `{"completed":true}`, false, false, false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(c.body))
+		r.Header.Set("Content-Type", c.contentType)
+		b, ok, err := ReadBody(r)
+		if ok != c.ok || (b.Ops != nil) != c.ops || (err != nil) != c.err {
+			t.Errorf("ReadBody(%s, %s) = %+v, %v, %v", c.contentType, c.body, b, ok, err)
+		}
+	}
+}
+
+func TestToMerge(t *testing.T) {
+	doc := map[string]interface{}{"title": "a", "time": "10:00"}
+	var ops []Op
+	if err := json.Unmarshal([]byte(`[{"op":"replace","path":"/title","value":"b"},{"op":"remove","path":"/time"}]`), &ops); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ToMerge(doc, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]json.RawMessage{"title": json.RawMessage(`"b"`), "time": json.RawMessage(`null`)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ToMerge = %s", got)
+	}
+	_, err = ToMerge(doc, []Op{{Op: "test", Path: "/title", Value: json.RawMessage(`"z"`)}})
+	if status, _ := Status(err); status != http.StatusConflict {
+		t.Errorf("failed test status = %d", status)
+	}
+	_, err = ToMerge(doc, []Op{{Op: "remove", Path: "/missing"}})
+	if status, _ := Status(err); status != http.StatusBadRequest {
+		t.Errorf("bad op status = %d", status)
+	}
+	if status, msg := Status(errors.New("boom")); status != http.StatusInternalServerError || msg == "boom" {
+		t.Errorf("other error = %d %q", status, msg)
+	}
+}
@@ -0,0 +1,157 @@
+package projects
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/validate"
+)
+
+const (
+	StatusActive    = "active"
+	StatusOnHold    = "on_hold"
+	StatusCompleted = "completed"
+)
+
+// Limits on project input.
+const (
+	MaxNameLength        = 100
+	MaxDescriptionLength = 2000
+)
+
+func ValidStatus(s string) bool {
+	return s == StatusActive || s == StatusOnHold || s == StatusCompleted
+}
+
+// Check checks the fields of a project being created or updated; nil fields
+// are not being set. An empty targetDate clears it. The error is
+// validate.Errors.
+func Check(name, description, targetDate *string) error {
+	var errs validate.Errors
+	if name != nil {
+		errs.String("name", strings.TrimSpace(*name), validate.Required, validate.MaxLength(MaxNameLength))
+	}
+	if description != nil {
+		errs.String("description", *description, validate.MaxLength(MaxDescriptionLength))
+	}
+	if targetDate != nil {
+		errs.String("targetDate", *targetDate, validate.Date)
+	}
+	return errs.Err()
+}
+
+type Project struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Status      string     `json:"status"`
+	TargetDate  *string    `json:"targetDate,omitempty"`
+	ArchivedAt  *time.Time `json:"archivedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	Progress    Progress   `json:"progress"`
+}
+
+// Progress is rolled up from a project's live todos. Each todo weighs the
+// same; a todo that is not completed counts for the share of its subtasks
+// that are done, so checking off subtasks moves the bar.
+type Progress struct {
+	Todos             int     `json:"todos"`
+	CompletedTodos    int     `json:"completedTodos"`
+	Subtasks          int     `json:"subtasks"`
+	CompletedSubtasks int     `json:"completedSubtasks"`
+	Percent           float64 `json:"percent"`
+}
+
+// TodoProgress is the input to Rollup for one todo.
+type TodoProgress struct {
+	Completed         bool
+	Subtasks          int
+	CompletedSubtasks int
+}
+
+func Rollup(items []TodoProgress) Progress {
+	var p Progress
+	var done float64
+	for _, it := range items {
+		p.Todos++
+		p.Subtasks += it.Subtasks
+		p.CompletedSubtasks += it.CompletedSubtasks
+		switch {
+		case it.Completed:
+			p.CompletedTodos++
+			done++
+		case it.Subtasks > 0:
+			done += float64(it.CompletedSubtasks) / float64(it.Subtasks)
+		}
+	}
+	if p.Todos > 0 {
+		p.Percent = math.Round(done/float64(p.Todos)*1000) / 10
+	}
+	return p
+}
+
+// List loads the user's projects matching where (a condition on projects
+// aliased p, with $1 bound to the user id) together with their progress.
+func List(ctx context.Context, q db.Querier, where string, args ...any) ([]Project, error) {
+	rows, err := q.Query(ctx, "SELECT p.id,p.name,COALESCE(p.description,''),p.status,to_char(p.target_date,'YYYY-MM-DD'),p.archived_at,p.created_at FROM projects p WHERE p.user_id=$1 AND "+where+" ORDER BY p.archived_at NULLS FIRST, p.target_date NULLS LAST, p.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Project{}
+	index := map[int64]int{}
+	var ids []int64
+	for rows.Next() {
+		var p Project
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Status, &p.TargetDate, &p.ArchivedAt, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		index[p.ID] = len(list)
+		ids = append(ids, p.ID)
+		list = append(list, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return list, nil
+	}
+	rows, err = q.Query(ctx, `
+        SELECT t.project_id, t.completed,
+               COUNT(s.id) AS subtasks,
+               COUNT(s.id) FILTER (WHERE s.completed) AS completed_subtasks
+        FROM todos t
+        LEFT JOIN subtasks s ON s.todo_id=t.id AND s.deleted_at IS NULL
+        WHERE t.project_id = ANY($1) AND t.deleted_at IS NULL
+        GROUP BY t.id
+    `, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := map[int64][]TodoProgress{}
+	for rows.Next() {
+		var pid int64
+		var it TodoProgress
+		if err := rows.Scan(&pid, &it.Completed, &it.Subtasks, &it.CompletedSubtasks); err != nil {
+			return nil, err
+		}
+		items[pid] = append(items[pid], it)
+	}
+	for pid, its := range items {
+		list[index[pid]].Progress = Rollup(its)
+	}
+	return list, rows.Err()
+}
+
+// Assignable reports whether todos may be put into project id: it must exist,
+// belong to the user and not be archived.
+func Assignable(ctx context.Context, q db.Querier, userID, id int64) (bool, error) {
+	var ok bool
+	err := q.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM projects WHERE id=$1 AND user_id=$2 AND archived_at IS NULL)", id, userID).Scan(&ok)
+	return ok, err
+}
@@ -0,0 +1,52 @@
+package projects
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"chronos-task-manager/pkg/validate"
+)
+
+func TestRollup(t *testing.T) {
+	p := Rollup([]TodoProgress{
+		{Completed: true, Subtasks: 2, CompletedSubtasks: 1},
+		{Subtasks: 4, CompletedSubtasks: 1},
+		{},
+		{Subtasks: 2, CompletedSubtasks: 2},
+	})
+	want := Progress{Todos: 4, CompletedTodos: 1, Subtasks: 8, CompletedSubtasks: 4, Percent: 56.3}
+	if p != want {
+		t.Fatalf("Rollup = %+v, want %+v", p, want)
+	}
+	if p := Rollup(nil); p != (Progress{}) {
+		t.Fatalf("empty rollup = %+v", p)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	str := func(s string) *string { return &s }
+	if err := Check(str("Launch"), str(""), str("2025-03-01")); err != nil {
+		t.Fatalf("valid project: %v", err)
+	}
+	if err := Check(nil, nil, str("")); err != nil {
+		t.Fatalf("clearing targetDate: %v", err)
+	}
+	var errs validate.Errors
+	if !errors.As(Check(str(" "), str(strings.Repeat("x", MaxDescriptionLength+1)), str("banana")), &errs) {
+		t.Fatal("want validate.Errors")
+	}
+	want := validate.Errors{
+		{Field: "description", Code: validate.CodeTooLong, Message: "must be at most 2000 characters"},
+		{Field: "name", Code: validate.CodeRequired, Message: "is required"},
+		{Field: "targetDate", Code: validate.CodeFormat, Message: "must be YYYY-MM-DD"},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("errs = %+v", errs)
+	}
+	for i := range want {
+		if errs[i] != want[i] {
+			t.Fatalf("errs[%d] = %+v, want %+v", i, errs[i], want[i])
+		}
+	}
+}
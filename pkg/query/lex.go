@@ -0,0 +1,166 @@
+package query
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+	tokTerm // field, op and value, e.g. due<2025-12-01
+	tokText // a bare word or quoted phrase
+)
+
+type token struct {
+	kind  tokenKind
+	col   int // 1-based column of the first character
+	field string
+	op    string
+	value string
+}
+
+// fieldOp matches the start of a term such as group:, due<= or cf.ticket=.
+var fieldOp = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_]*(?:\.[A-Za-z][A-Za-z0-9_]*)?)(<=|>=|!=|:|<|>|=)`)
+
+type lexer struct {
+	src  string
+	i    int
+	toks []token
+}
+
+func lex(src string) ([]token, error) {
+	l := &lexer{src: src}
+	for {
+		r, size := l.peek()
+		switch {
+		case size == 0:
+			l.toks = append(l.toks, token{kind: tokEOF, col: l.col(l.i)})
+			return l.toks, nil
+		case unicode.IsSpace(r):
+			l.i += size
+		case r == '(':
+			l.emit(tokLParen)
+		case r == ')':
+			l.emit(tokRParen)
+		case r == '"':
+			start := l.i
+			s, err := l.quoted()
+			if err != nil {
+				return nil, err
+			}
+			l.toks = append(l.toks, token{kind: tokText, col: l.col(start), value: s})
+		case r == '-' && l.startsWord(l.i+size):
+			// -term is shorthand for NOT term.
+			l.emit(tokNot)
+		default:
+			if err := l.word(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (l *lexer) peek() (rune, int) {
+	if l.i >= len(l.src) {
+		return 0, 0
+	}
+	return utf8.DecodeRuneInString(l.src[l.i:])
+}
+
+func (l *lexer) col(i int) int {
+	return utf8.RuneCountInString(l.src[:i]) + 1
+}
+
+func (l *lexer) emit(kind tokenKind) {
+	l.toks = append(l.toks, token{kind: kind, col: l.col(l.i)})
+	l.i++
+}
+
+// startsWord reports whether a word or phrase begins at i.
+func (l *lexer) startsWord(i int) bool {
+	if i >= len(l.src) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[i:])
+	return !unicode.IsSpace(r) && r != '(' && r != ')'
+}
+
+// quoted reads a double-quoted string starting at l.i; \" and \\ escape.
+func (l *lexer) quoted() (string, error) {
+	start := l.i
+	l.i++
+	var b strings.Builder
+	for l.i < len(l.src) {
+		c := l.src[l.i]
+		switch {
+		case c == '\\' && l.i+1 < len(l.src) && (l.src[l.i+1] == '"' || l.src[l.i+1] == '\\'):
+			b.WriteByte(l.src[l.i+1])
+			l.i += 2
+		case c == '"':
+			l.i++
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+			l.i++
+		}
+	}
+	return "", errorf(l.col(start), "unterminated quote")
+}
+
+func (l *lexer) word() error {
+	start := l.i
+	for l.i < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.i:])
+		if unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' {
+			break
+		}
+		l.i += size
+	}
+	w := l.src[start:l.i]
+	switch w {
+	case "AND":
+		l.toks = append(l.toks, token{kind: tokAnd, col: l.col(start)})
+		return nil
+	case "OR":
+		l.toks = append(l.toks, token{kind: tokOr, col: l.col(start)})
+		return nil
+	case "NOT":
+		l.toks = append(l.toks, token{kind: tokNot, col: l.col(start)})
+		return nil
+	}
+	m := fieldOp.FindStringSubmatch(w)
+	if m == nil {
+		l.toks = append(l.toks, token{kind: tokText, col: l.col(start), value: w})
+		return nil
+	}
+	// Field names are case-insensitive; custom field keys are not.
+	field := m[1]
+	if prefix, key, ok := strings.Cut(field, "."); ok {
+		field = strings.ToLower(prefix) + "." + key
+	} else {
+		field = strings.ToLower(field)
+	}
+	t := token{kind: tokTerm, col: l.col(start), field: field, op: m[2], value: w[len(m[0]):]}
+	if t.value == "" {
+		if r, _ := l.peek(); r == '"' {
+			s, err := l.quoted()
+			if err != nil {
+				return err
+			}
+			t.value = s
+		} else {
+			return errorf(l.col(start+len(m[0])), "missing value after %s%s", m[1], m[2])
+		}
+	}
+	l.toks = append(l.toks, t)
+	return nil
+}
@@ -0,0 +1,389 @@
+// Package query parses the todo filter language, e.g.
+//
+//	group:work is:open due<2025-12-01 tag:urgent "quarterly report" sort:-due
+//
+// Terms next to each other must all match; OR, NOT (or a leading -) and
+// parentheses combine them. A parsed Query turns into a parameterized WHERE
+// condition on the todos table, so values never end up in the SQL text.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"chronos-task-manager/pkg/fields"
+)
+
+// Error is a syntax or validation error at a 1-based column of the input.
+type Error struct {
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("query column %d: %s", e.Column, e.Msg)
+}
+
+func errorf(col int, format string, args ...interface{}) error {
+	return &Error{Column: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Node is a boolean expression over todos.
+type Node interface{ node() }
+
+type And struct{ L, R Node }
+type Or struct{ L, R Node }
+type Not struct{ X Node }
+
+// Term is a field condition. Op is one of =, !=, <, <=, >, >= (":" is
+// stored as "=").
+type Term struct {
+	Field string
+	Op    string
+	Value string
+}
+
+// Text matches a word or phrase in the title or description.
+type Text struct{ Value string }
+
+func (And) node()  {}
+func (Or) node()   {}
+func (Not) node()  {}
+func (Term) node() {}
+func (Text) node() {}
+
+// Query is a parsed filter. Expr is nil when the query only sorts or is
+// empty.
+type Query struct {
+	Expr Node
+	Sort []SortKey
+}
+
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindDate
+	kindNumber
+	kindProject
+	kindIs
+	kindHas
+	kindContains
+	kindCustom
+)
+
+const (
+	eqOps  = "= !="
+	allOps = "= != < <= > >="
+)
+
+var specs = map[string]struct {
+	ops  string
+	kind valueKind
+}{
+	"group":    {eqOps, kindString},
+	"tag":      {eqOps, kindString},
+	"project":  {eqOps, kindProject},
+	"is":       {"=", kindIs},
+	"has":      {"=", kindHas},
+	"date":     {allOps, kindDate},
+	"due":      {allOps, kindDate},
+	"defer":    {allOps, kindDate},
+	"created":  {allOps, kindDate},
+	"estimate": {allOps, kindNumber},
+	"title":    {"=", kindContains},
+}
+
+var isValues = []string{"open", "done", "completed", "blocked", "deferred", "overdue"}
+var hasValues = []string{"deadline", "estimate", "project", "time", "description", "tags", "subtasks", "comments", "attachments"}
+
+// Parse parses src. Errors are *Error values pointing at the offending
+// column.
+func Parse(src string) (*Query, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorf(t.col, "unexpected %s", describe(t))
+	}
+	return &Query{Expr: expr, Sort: p.sort}, nil
+}
+
+type parser struct {
+	toks  []token
+	pos   int
+	depth int // open parentheses and NOTs around the current token
+	sort  []SortKey
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) or() (Node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		op := p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		if left == nil || right == nil {
+			return nil, errorf(op.col, "OR needs a condition on both sides")
+		}
+		left = Or{left, right}
+	}
+	return left, nil
+}
+
+// and parses a run of conditions joined by AND or plain juxtaposition. Sort
+// terms are taken out of the run, so it may come back nil.
+func (p *parser) and() (Node, error) {
+	var node Node
+	first := true
+	for {
+		t := p.peek()
+		switch t.kind {
+		case tokEOF, tokRParen, tokOr:
+			return node, nil
+		case tokAnd:
+			p.next()
+			if first {
+				return nil, errorf(t.col, "AND needs a condition on both sides")
+			}
+			if k := p.peek().kind; k == tokEOF || k == tokRParen || k == tokOr || k == tokAnd {
+				return nil, errorf(t.col, "AND needs a condition on both sides")
+			}
+		}
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		first = false
+		if n == nil {
+			continue
+		}
+		if node == nil {
+			node = n
+		} else {
+			node = And{node, n}
+		}
+	}
+}
+
+func (p *parser) unary() (Node, error) {
+	if t := p.peek(); t.kind == tokNot {
+		p.next()
+		p.depth++
+		x, err := p.unary()
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		return Not{x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		p.depth++
+		x, err := p.or()
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, errorf(t.col, "missing closing parenthesis")
+		}
+		p.next()
+		if x == nil {
+			return nil, errorf(t.col, "empty parentheses")
+		}
+		return x, nil
+	case tokText:
+		return Text{t.value}, nil
+	case tokTerm:
+		if t.field == "sort" {
+			return nil, p.sortTerm(t)
+		}
+		return term(t)
+	case tokEOF:
+		return nil, errorf(t.col, "expected a condition at end of query")
+	}
+	return nil, errorf(t.col, "unexpected %s", describe(t))
+}
+
+func (p *parser) sortTerm(t token) error {
+	if p.depth > 0 {
+		return errorf(t.col, "sort: cannot be used inside NOT or parentheses")
+	}
+	if t.op != ":" {
+		return errorf(t.col, "use sort:field or sort:-field")
+	}
+	key, err := sortKey(t.value)
+	if err != nil {
+		return errorf(t.col, "%s", err.Error())
+	}
+	for _, k := range p.sort {
+		if k.Field == key.Field {
+			return errorf(t.col, "sorted by %s twice", key.Field)
+		}
+	}
+	p.sort = append(p.sort, key)
+	return nil
+}
+
+func sortKey(v string) (SortKey, error) {
+	key := SortKey{Field: strings.ToLower(v)}
+	if strings.HasPrefix(key.Field, "-") {
+		key.Field, key.Desc = key.Field[1:], true
+	}
+	if _, ok := sortFields[key.Field]; !ok {
+		return key, fmt.Errorf("cannot sort by %q, use one of %s", v, strings.Join(SortFields(), ", "))
+	}
+	return key, nil
+}
+
+// ParseSort parses a comma-separated list of sort fields such as
+// "-due,title", in the form sort: takes.
+func ParseSort(spec string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		key, err := sortKey(part)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			if k.Field == key.Field {
+				return nil, fmt.Errorf("sorted by %s twice", key.Field)
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// term validates a field condition.
+func term(t token) (Node, error) {
+	op := t.op
+	if op == ":" {
+		op = "="
+	}
+	kind := kindCustom
+	ops := allOps
+	if key, ok := strings.CutPrefix(t.field, "cf."); ok {
+		if !fields.ValidKey(key) {
+			return nil, errorf(t.col, "invalid custom field key %q", key)
+		}
+	} else {
+		spec, ok := specs[t.field]
+		if !ok {
+			return nil, errorf(t.col, "unknown field %q", t.field)
+		}
+		kind, ops = spec.kind, spec.ops
+	}
+	if !strings.Contains(" "+ops+" ", " "+op+" ") {
+		return nil, errorf(t.col, "%s does not support %s", t.field, t.op)
+	}
+	valueCol := t.col + len([]rune(t.field)) + len(t.op)
+	switch kind {
+	case kindDate:
+		if _, ok := relativeDays[strings.ToLower(t.value)]; ok {
+			break
+		}
+		if _, err := time.Parse("2006-01-02", t.value); err != nil {
+			return nil, errorf(valueCol, "%q is not a date, use YYYY-MM-DD, today, tomorrow or yesterday", t.value)
+		}
+	case kindNumber:
+		if _, err := strconv.ParseFloat(t.value, 64); err != nil {
+			return nil, errorf(valueCol, "%q is not a number", t.value)
+		}
+	case kindProject:
+		if t.value != "none" {
+			if id, err := strconv.ParseInt(t.value, 10, 64); err != nil || id <= 0 {
+				return nil, errorf(valueCol, "project must be an id or none")
+			}
+		}
+	case kindIs:
+		if !oneOf(t.value, isValues) {
+			return nil, errorf(valueCol, "is: expects one of %s", strings.Join(isValues, ", "))
+		}
+	case kindHas:
+		if !oneOf(t.value, hasValues) {
+			return nil, errorf(valueCol, "has: expects one of %s", strings.Join(hasValues, ", "))
+		}
+	}
+	return Term{Field: t.field, Op: op, Value: t.value}, nil
+}
+
+var relativeDays = map[string]int{"yesterday": -1, "today": 0, "tomorrow": 1}
+
+func oneOf(v string, list []string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokRParen:
+		return `")"`
+	case tokLParen:
+		return `"("`
+	case tokAnd:
+		return "AND"
+	case tokOr:
+		return "OR"
+	case tokNot:
+		return "NOT"
+	case tokEOF:
+		return "end of query"
+	}
+	return fmt.Sprintf("%q", t.value)
+}
+
+// Uses reports whether the query has a condition on field, counting
+// is:<value> and has:<value> as fields of their own (e.g. "deferred").
+func (q *Query) Uses(field string) bool {
+	var walk func(Node) bool
+	walk = func(n Node) bool {
+		switch n := n.(type) {
+		case And:
+			return walk(n.L) || walk(n.R)
+		case Or:
+			return walk(n.L) || walk(n.R)
+		case Not:
+			return walk(n.X)
+		case Term:
+			return n.Field == field || ((n.Field == "is" || n.Field == "has") && n.Value == field)
+		}
+		return false
+	}
+	return walk(q.Expr)
+}
@@ -0,0 +1,214 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"chronos-task-manager/pkg/page"
+	"chronos-task-manager/pkg/todos"
+)
+
+func TestParse(t *testing.T) {
+	q, err := Parse(`group:work is:open due<2025-12-01 tag:urgent "quarterly report"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := And{And{And{And{
+		Term{"group", "=", "work"},
+		Term{"is", "=", "open"}},
+		Term{"due", "<", "2025-12-01"}},
+		Term{"tag", "=", "urgent"}},
+		Text{"quarterly report"}}
+	if !reflect.DeepEqual(q.Expr, want) {
+		t.Errorf("Expr = %#v", q.Expr)
+	}
+}
+
+func TestParsePrecedence(t *testing.T) {
+	cases := map[string]Node{
+		"a OR b c":         Or{Text{"a"}, And{Text{"b"}, Text{"c"}}},
+		"(a OR b) c":       And{Or{Text{"a"}, Text{"b"}}, Text{"c"}},
+		"a AND NOT b":      And{Text{"a"}, Not{Text{"b"}}},
+		"-tag:x -y":        And{Not{Term{"tag", "=", "x"}}, Not{Text{"y"}}},
+		"NOT (a OR b)":     Not{Or{Text{"a"}, Text{"b"}}},
+		`title:"a \"b\""`:  Term{"title", "=", `a "b"`},
+		"Group=Home":       Term{"group", "=", "Home"},
+		"estimate>=30":     Term{"estimate", ">=", "30"},
+		"cf.points>3":      Term{"cf.points", ">", "3"},
+		"state-of-the-art": Text{"state-of-the-art"},
+		"and or":           And{Text{"and"}, Text{"or"}},
+	}
+	for src, want := range cases {
+		q, err := Parse(src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", src, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Expr, want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", src, q.Expr, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		src string
+		col int
+		msg string
+	}{
+		{"is:open (a OR b", 9, "missing closing parenthesis"},
+		{"a )", 3, `unexpected ")"`},
+		{"()", 1, "empty parentheses"},
+		{"OR a", 1, "OR needs a condition on both sides"},
+		{"a OR", 3, "OR needs a condition on both sides"},
+		{"a AND", 3, "AND needs a condition on both sides"},
+		{"NOT", 4, "expected a condition at end of query"},
+		{`"open`, 1, "unterminated quote"},
+		{"color:red", 1, `unknown field "color"`},
+		{"due<tomorow", 5, `"tomorow" is not a date`},
+		{"is:sleeping", 4, "is: expects one of"},
+		{"group<b", 1, "group does not support <"},
+		{"estimate>lots", 10, `"lots" is not a number`},
+		{"tag:", 5, "missing value after tag:"},
+		{"日本 due:x", 8, `"x" is not a date`},
+		{"-(sort:date)", 3, "sort: cannot be used inside NOT or parentheses"},
+		{"sort:colour", 1, `cannot sort by "colour"`},
+		{"cf.Bad:1", 1, `invalid custom field key "Bad"`},
+	}
+	for _, c := range cases {
+		_, err := Parse(c.src)
+		var qe *Error
+		if !errors.As(err, &qe) {
+			t.Errorf("Parse(%q) error = %v, want *Error", c.src, err)
+			continue
+		}
+		if qe.Column != c.col || !strings.Contains(qe.Msg, c.msg) {
+			t.Errorf("Parse(%q) = column %d %q, want column %d %q", c.src, qe.Column, qe.Msg, c.col, c.msg)
+		}
+	}
+}
+
+func TestWhere(t *testing.T) {
+	q, err := Parse(`group:work is:open due<tomorrow -tag:later ("big one" OR project:none)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args := q.Where(Options{Today: "2025-03-31"}, 3)
+	want := "((((COALESCE(group_id=$3,false) AND COALESCE(NOT completed,false)) AND COALESCE(deadline<$4::date,false))" +
+		" AND NOT COALESCE($5=ANY(tags),false))" +
+		" AND (COALESCE(title ILIKE $6 OR description ILIKE $6,false) OR COALESCE(project_id IS NULL,false)))"
+	if sql != want {
+		t.Errorf("sql =\n%s\nwant\n%s", sql, want)
+	}
+	wantArgs := []interface{}{"work", "2025-04-01", "later", "%big one%"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %v, want %v", args, wantArgs)
+	}
+}
+
+func TestWhereEscapesAndCustomFields(t *testing.T) {
+	q, err := Parse(`100% cf.points>=3 cf.team!=ops`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args := q.Where(Options{Today: "2025-01-01"}, 1)
+	if !strings.Contains(sql, "NOT COALESCE(custom_fields->>$4 = $5,false))") {
+		t.Errorf("sql = %s", sql)
+	}
+	want := []interface{}{`%100\%%`, "points", 3.0, "team", "ops"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestEmptyAndSortOnly(t *testing.T) {
+	q, err := Parse("  sort:-due sort:title ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Expr != nil {
+		t.Errorf("Expr = %#v", q.Expr)
+	}
+	if sql, _ := q.Where(Options{}, 1); sql != "" {
+		t.Errorf("Where = %q", sql)
+	}
+	want := []SortKey{{"due", true}, {"title", false}}
+	if !reflect.DeepEqual(q.Sort, want) {
+		t.Errorf("Sort = %v", q.Sort)
+	}
+	if _, err := Parse("sort:date sort:-date"); err == nil {
+		t.Error("duplicate sort accepted")
+	}
+}
+
+func TestUses(t *testing.T) {
+	q, _ := Parse("a OR -is:deferred")
+	if !q.Uses("deferred") || q.Uses("defer") {
+		t.Error("Uses(deferred) wrong")
+	}
+	q, _ = Parse("defer>today")
+	if !q.Uses("defer") {
+		t.Error("Uses(defer) wrong")
+	}
+}
+
+func TestOrderAndAfter(t *testing.T) {
+	keys := []SortKey{{"due", false}, {"estimate", true}}
+	if got := OrderBy(keys, false); got != "ORDER BY COALESCE(deadline,'infinity'::date) ASC, COALESCE(estimate_minutes,-1) DESC, id DESC" {
+		t.Errorf("OrderBy = %s", got)
+	}
+	if got := OrderBy(keys, true); got != "ORDER BY COALESCE(deadline,'infinity'::date) DESC, COALESCE(estimate_minutes,-1) ASC, id ASC" {
+		t.Errorf("OrderBy backward = %s", got)
+	}
+	todo := todos.Todo{ID: 7, Title: "x"}
+	c := CursorFor(keys, todo)
+	if c.Key != `["infinity","-1"]` || c.ID != 7 {
+		t.Fatalf("CursorFor = %+v", c)
+	}
+	sql, args, err := After(keys, c, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "((COALESCE(deadline,'infinity'::date)>$4::date)" +
+		" OR (COALESCE(deadline,'infinity'::date)=$4::date AND COALESCE(estimate_minutes,-1)<$5::int)" +
+		" OR (COALESCE(deadline,'infinity'::date)=$4::date AND COALESCE(estimate_minutes,-1)=$5::int AND id<$6))"
+	if sql != want {
+		t.Errorf("After =\n%s\nwant\n%s", sql, want)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"infinity", "-1", int64(7)}) {
+		t.Errorf("args = %v", args)
+	}
+
+	date := []SortKey{{"date", true}}
+	c = CursorFor(date, todos.Todo{ID: 3, Date: "2025-02-01"})
+	if c.Key != "2025-02-01" {
+		t.Errorf("single key cursor = %q", c.Key)
+	}
+	c.Backward = true
+	sql, _, _ = After(date, c, 2)
+	if sql != "((date>$2::date) OR (date=$2::date AND id>$3))" {
+		t.Errorf("After backward = %s", sql)
+	}
+	for _, bad := range []page.Cursor{{Key: "nope", ID: 1}, {Key: `["x"]`, ID: 1}} {
+		if _, _, err := After(keys[:len(bad.Key)%2+1], bad, 1); !errors.Is(err, page.ErrInvalidCursor) {
+			t.Errorf("After(%+v) err = %v", bad, err)
+		}
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	keys, err := ParseSort(" -due, title ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []SortKey{{"due", true}, {"title", false}}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("ParseSort = %v", keys)
+	}
+	for _, bad := range []string{"colour", "due,-due"} {
+		if _, err := ParseSort(bad); err == nil {
+			t.Errorf("ParseSort(%q) = nil error", bad)
+		}
+	}
+}
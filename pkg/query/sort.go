@@ -0,0 +1,182 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"chronos-task-manager/pkg/page"
+	"chronos-task-manager/pkg/todos"
+)
+
+// SortKey orders todos by one field. id breaks ties, in the direction of
+// the last key.
+type SortKey struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+type sortField struct {
+	expr  string // SQL expression on todos; NULLs are mapped to a sentinel
+	cast  string
+	value func(todos.Todo) string
+}
+
+var sortFields = map[string]sortField{
+	"date": {"date", "date", func(t todos.Todo) string { return t.Date }},
+	"due": {"COALESCE(deadline,'infinity'::date)", "date", func(t todos.Todo) string {
+		if t.Deadline == nil {
+			return "infinity"
+		}
+		return *t.Deadline
+	}},
+	"title": {"title", "text", func(t todos.Todo) string { return t.Title }},
+	"group": {"group_id", "text", func(t todos.Todo) string { return t.GroupID }},
+	"project": {"COALESCE(project_id,0)", "bigint", func(t todos.Todo) string {
+		if t.ProjectID == nil {
+			return "0"
+		}
+		return strconv.FormatInt(*t.ProjectID, 10)
+	}},
+	"estimate": {"COALESCE(estimate_minutes,-1)", "int", func(t todos.Todo) string {
+		if t.EstimateMinutes == nil {
+			return "-1"
+		}
+		return strconv.Itoa(*t.EstimateMinutes)
+	}},
+}
+
+// SortFields lists the fields sort: accepts.
+func SortFields() []string {
+	list := make([]string, 0, len(sortFields))
+	for k := range sortFields {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// OrderBy returns the ORDER BY clause for keys. backward reverses every
+// direction, for fetching the page before a cursor.
+func OrderBy(keys []SortKey, backward bool) string {
+	parts := make([]string, 0, len(keys)+1)
+	for _, k := range keys {
+		parts = append(parts, sortFields[k.Field].expr+" "+direction(k.Desc != backward))
+	}
+	parts = append(parts, "id "+direction(lastDesc(keys) != backward))
+	return "ORDER BY " + strings.Join(parts, ", ")
+}
+
+func direction(desc bool) string {
+	if desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func lastDesc(keys []SortKey) bool {
+	return len(keys) > 0 && keys[len(keys)-1].Desc
+}
+
+// After returns the condition selecting the rows past c in the order of
+// keys, with placeholders from $n. Keys may mix directions, so the
+// condition is spelled out as (a > x) OR (a = x AND b > y) OR ...
+func After(keys []SortKey, c page.Cursor, n int) (string, []interface{}, error) {
+	values, err := cursorValues(keys, c.Key)
+	if err != nil {
+		return "", nil, err
+	}
+	type col struct {
+		expr string
+		desc bool
+		arg  interface{}
+	}
+	cols := make([]col, 0, len(keys)+1)
+	for i, k := range keys {
+		f := sortFields[k.Field]
+		cols = append(cols, col{f.expr, k.Desc, values[i]})
+	}
+	cols = append(cols, col{"id", lastDesc(keys), c.ID})
+
+	var args []interface{}
+	placeholders := make([]string, len(cols))
+	for i, cl := range cols {
+		args = append(args, cl.arg)
+		placeholders[i] = fmt.Sprintf("$%d", n+i)
+		if i < len(keys) {
+			placeholders[i] += "::" + sortFields[keys[i].Field].cast
+		}
+	}
+	var ors []string
+	for i, cl := range cols {
+		cmp := ">"
+		if cl.desc != c.Backward {
+			cmp = "<"
+		}
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, cols[j].expr+"="+placeholders[j])
+		}
+		ands = append(ands, cl.expr+cmp+placeholders[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args, nil
+}
+
+// CursorFor returns the cursor of t in the order of keys. A single key is
+// stored as is; several are stored as a JSON array.
+func CursorFor(keys []SortKey, t todos.Todo) page.Cursor {
+	c := page.Cursor{ID: t.ID}
+	switch len(keys) {
+	case 0:
+	case 1:
+		c.Key = sortFields[keys[0].Field].value(t)
+	default:
+		values := make([]string, len(keys))
+		for i, k := range keys {
+			values[i] = sortFields[k.Field].value(t)
+		}
+		b, _ := json.Marshal(values)
+		c.Key = string(b)
+	}
+	return c
+}
+
+func cursorValues(keys []SortKey, key string) ([]string, error) {
+	switch len(keys) {
+	case 0:
+		return nil, nil
+	case 1:
+		if !validValue(sortFields[keys[0].Field].cast, key) {
+			return nil, page.ErrInvalidCursor
+		}
+		return []string{key}, nil
+	}
+	var values []string
+	if json.Unmarshal([]byte(key), &values) != nil || len(values) != len(keys) {
+		return nil, page.ErrInvalidCursor
+	}
+	for i, k := range keys {
+		if !validValue(sortFields[k.Field].cast, values[i]) {
+			return nil, page.ErrInvalidCursor
+		}
+	}
+	return values, nil
+}
+
+// validValue keeps a tampered cursor from failing the query with a cast
+// error.
+func validValue(cast, v string) bool {
+	switch cast {
+	case "date":
+		_, err := time.Parse("2006-01-02", v)
+		return err == nil || v == "infinity"
+	case "int", "bigint":
+		_, err := strconv.ParseInt(v, 10, 64)
+		return err == nil
+	}
+	return true
+}
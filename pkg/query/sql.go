@@ -0,0 +1,144 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"chronos-task-manager/pkg/fields"
+)
+
+// Options carries what a query needs to know about the caller at run time.
+type Options struct {
+	// Today is the caller's local date (YYYY-MM-DD); today, tomorrow,
+	// yesterday, is:deferred and is:overdue are relative to it.
+	Today string
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// dateColumns maps the date fields to their column on todos.
+var dateColumns = map[string]string{
+	"date":    "date",
+	"due":     "deadline",
+	"defer":   "defer_until",
+	"created": "created_at::date",
+}
+
+var hasConds = map[string]string{
+	"deadline":    "deadline IS NOT NULL",
+	"estimate":    "estimate_minutes IS NOT NULL",
+	"project":     "project_id IS NOT NULL",
+	"time":        "COALESCE(time,'')<>''",
+	"description": "COALESCE(description,'')<>''",
+	"tags":        "cardinality(tags)>0",
+	"subtasks":    "EXISTS(SELECT 1 FROM subtasks s WHERE s.todo_id=todos.id AND s.deleted_at IS NULL)",
+	"comments":    "EXISTS(SELECT 1 FROM todo_comments c WHERE c.todo_id=todos.id)",
+	"attachments": "EXISTS(SELECT 1 FROM attachments a WHERE a.todo_id=todos.id)",
+}
+
+const blockedCond = "EXISTS(SELECT 1 FROM todo_dependencies d JOIN todos b ON b.id=d.blocked_by WHERE d.todo_id=todos.id AND NOT b.completed AND b.deleted_at IS NULL)"
+
+// Where compiles the filter into a condition on the todos table whose
+// placeholders start at $n, and the matching args. It returns "" when the
+// query has no filter.
+func (q *Query) Where(opts Options, n int) (string, []interface{}) {
+	if q.Expr == nil {
+		return "", nil
+	}
+	b := &builder{opts: opts, n: n}
+	return b.node(q.Expr), b.args
+}
+
+type builder struct {
+	opts Options
+	n    int
+	args []interface{}
+}
+
+// arg adds v and returns its placeholder.
+func (b *builder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", b.n+len(b.args)-1)
+}
+
+func (b *builder) node(n Node) string {
+	switch n := n.(type) {
+	case And:
+		return "(" + b.node(n.L) + " AND " + b.node(n.R) + ")"
+	case Or:
+		return "(" + b.node(n.L) + " OR " + b.node(n.R) + ")"
+	case Not:
+		return "NOT " + b.node(n.X)
+	case Text:
+		p := b.arg("%" + likeEscaper.Replace(n.Value) + "%")
+		return fmt.Sprintf("COALESCE(title ILIKE %[1]s OR description ILIKE %[1]s,false)", p)
+	case Term:
+		if n.Op == "!=" {
+			n.Op = "="
+			return "NOT " + b.node(n)
+		}
+		// Terms on NULL columns are false rather than unknown, so that NOT
+		// due<2025-01-01 also matches todos without a deadline.
+		return "COALESCE(" + b.term(n) + ",false)"
+	}
+	panic(fmt.Sprintf("query: unexpected node %T", n))
+}
+
+func (b *builder) term(t Term) string {
+	op := t.Op
+	switch t.Field {
+	case "group":
+		return "group_id=" + b.arg(t.Value)
+	case "tag":
+		return b.arg(t.Value) + "=ANY(tags)"
+	case "project":
+		if t.Value == "none" {
+			return "project_id IS NULL"
+		}
+		return "project_id=" + b.arg(t.Value) + "::bigint"
+	case "is":
+		switch t.Value {
+		case "open":
+			return "NOT completed"
+		case "done", "completed":
+			return "completed"
+		case "blocked":
+			return blockedCond
+		case "deferred":
+			return "defer_until>" + b.arg(b.opts.Today) + "::date"
+		case "overdue":
+			return "NOT completed AND deadline<" + b.arg(b.opts.Today) + "::date"
+		}
+	case "has":
+		return hasConds[t.Value]
+	case "date", "due", "defer", "created":
+		return dateColumns[t.Field] + op + b.arg(b.date(t.Value)) + "::date"
+	case "estimate":
+		return "estimate_minutes" + op + b.arg(t.Value) + "::numeric"
+	case "title":
+		return "title ILIKE " + b.arg("%"+likeEscaper.Replace(t.Value)+"%")
+	}
+	if key, ok := strings.CutPrefix(t.Field, "cf."); ok {
+		f := fields.Filter{Key: key, Op: filterOps[t.Op], Value: t.Value}
+		cond, args := f.SQL(b.n + len(b.args))
+		b.args = append(b.args, args...)
+		return cond
+	}
+	panic("query: unexpected field " + t.Field)
+}
+
+var filterOps = map[string]string{"=": "eq", ">=": "gte", "<=": "lte", ">": "gt", "<": "lt"}
+
+// date resolves today, tomorrow and yesterday against Options.Today.
+func (b *builder) date(v string) string {
+	days, ok := relativeDays[strings.ToLower(v)]
+	if !ok {
+		return v
+	}
+	today, err := time.Parse("2006-01-02", b.opts.Today)
+	if err != nil {
+		today = time.Now().UTC()
+	}
+	return today.AddDate(0, 0, days).Format("2006-01-02")
+}
@@ -0,0 +1,128 @@
+package rollover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/history"
+	"chronos-task-manager/pkg/settings"
+	"chronos-task-manager/pkg/todos"
+)
+
+// Copy pairs an unfinished todo with the copy made of it.
+type Copy struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// Result describes one rollover.
+type Result struct {
+	Date   string  `json:"date"`
+	Mode   string  `json:"mode"`
+	Moved  []int64 `json:"moved"`
+	Copied []Copy  `json:"copied"`
+}
+
+// Today returns the date at now in loc as YYYY-MM-DD.
+func Today(loc *time.Location, now time.Time) string {
+	return now.In(loc).Format("2006-01-02")
+}
+
+// Due reports whether the scheduled rollover should run for a user with
+// settings s at now, and the local day it rolls over to. It runs once per
+// local day and never when rollover is off.
+func Due(s settings.Settings, now time.Time) (string, bool) {
+	today := Today(s.Location(), now)
+	if s.RolloverMode != settings.RolloverMove && s.RolloverMode != settings.RolloverCopy {
+		return today, false
+	}
+	return today, s.LastRolloverDate < today
+}
+
+// Run rolls the user's unfinished todos dated before today over to today.
+// With RolloverMove they are redated; with RolloverCopy a copy including the
+// subtasks is created on today and the original keeps its date and points
+// at the copy, so it is not rolled over again. Either way the rollover count
+// goes up by one and the change is recorded in the history. Run should be
+// called inside a transaction.
+func Run(ctx context.Context, q db.Querier, userID int64, mode, today string) (Result, error) {
+	res := Result{Date: today, Mode: mode, Moved: []int64{}, Copied: []Copy{}}
+	if mode != settings.RolloverMove && mode != settings.RolloverCopy {
+		return res, fmt.Errorf("invalid rollover mode %q", mode)
+	}
+	rows, err := q.Query(ctx, "SELECT id FROM todos WHERE user_id=$1 AND deleted_at IS NULL AND NOT completed AND rolled_over_to IS NULL AND date < $2::date AND (defer_until IS NULL OR defer_until <= $2::date) ORDER BY date, id FOR UPDATE", userID, today)
+	if err != nil {
+		return res, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return res, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+
+	for _, id := range ids {
+		before, err := history.SnapshotTodo(ctx, q, userID, id)
+		if err != nil {
+			return res, err
+		}
+		if mode == settings.RolloverMove {
+			if _, err := q.Exec(ctx, "UPDATE todos SET date=$2, rollover_count=rollover_count+1 WHERE id=$1", id, today); err != nil {
+				return res, err
+			}
+			if err := record(ctx, q, userID, id, history.ActionUpdate, before); err != nil {
+				return res, err
+			}
+			res.Moved = append(res.Moved, id)
+			continue
+		}
+		copyID, err := copyTodo(ctx, q, id, today)
+		if err != nil {
+			return res, err
+		}
+		if _, err := q.Exec(ctx, "UPDATE todos SET rolled_over_to=$2 WHERE id=$1", id, copyID); err != nil {
+			return res, err
+		}
+		if err := record(ctx, q, userID, copyID, history.ActionCreate, nil); err != nil {
+			return res, err
+		}
+		if err := record(ctx, q, userID, id, history.ActionUpdate, before); err != nil {
+			return res, err
+		}
+		res.Copied = append(res.Copied, Copy{From: id, To: copyID})
+	}
+	return res, settings.MarkRolledOver(ctx, q, userID, today)
+}
+
+// copyTodo duplicates an unfinished todo onto day, subtasks included.
+func copyTodo(ctx context.Context, q db.Querier, id int64, day string) (int64, error) {
+	var copyID int64
+	err := q.QueryRow(ctx, `INSERT INTO todos(user_id,title,description,date,deadline,time,group_id,project_id,estimate_minutes,tags,custom_fields,completed,rollover_count)
+        SELECT user_id,title,description,$2,deadline,time,group_id,project_id,estimate_minutes,tags,custom_fields,false,rollover_count+1 FROM todos WHERE id=$1 RETURNING id`, id, day).Scan(&copyID)
+	if err != nil {
+		return 0, err
+	}
+	flat, err := todos.Flat(ctx, q, id)
+	if err != nil {
+		return 0, err
+	}
+	return copyID, todos.InsertSubtasks(ctx, q, copyID, nil, todos.BuildTree(flat))
+}
+
+func record(ctx context.Context, q db.Querier, userID, id int64, action string, before json.RawMessage) error {
+	after, err := history.SnapshotTodo(ctx, q, userID, id)
+	if err != nil {
+		return err
+	}
+	return history.Record(ctx, q, userID, history.Entry{TodoID: id, Entity: history.EntityTodo, Action: action, Before: before, After: after, ActorID: userID})
+}
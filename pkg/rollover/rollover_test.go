@@ -0,0 +1,40 @@
+package rollover
+
+import (
+	"testing"
+	"time"
+
+	"chronos-task-manager/pkg/settings"
+)
+
+func TestToday(t *testing.T) {
+	now := time.Date(2025, 3, 1, 17, 30, 0, 0, time.UTC)
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	if got := Today(shanghai, now); got != "2025-03-02" {
+		t.Errorf("Today(Shanghai) = %s", got)
+	}
+	if got := Today(time.UTC, now); got != "2025-03-01" {
+		t.Errorf("Today(UTC) = %s", got)
+	}
+}
+
+func TestDue(t *testing.T) {
+	now := time.Date(2025, 3, 1, 17, 30, 0, 0, time.UTC)
+	s := settings.Default()
+	if _, due := Due(s, now); due {
+		t.Error("rollover off should never be due")
+	}
+	s.RolloverMode = settings.RolloverMove
+	if day, due := Due(s, now); !due || day != "2025-03-01" {
+		t.Errorf("first rollover = %s, %v", day, due)
+	}
+	s.LastRolloverDate = "2025-03-01"
+	if _, due := Due(s, now); due {
+		t.Error("second rollover on the same day")
+	}
+	// Already the next day in Shanghai.
+	s.Timezone = "Asia/Shanghai"
+	if day, due := Due(s, now); !due || day != "2025-03-02" {
+		t.Errorf("next local day = %s, %v", day, due)
+	}
+}
@@ -0,0 +1,134 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/db"
+)
+
+// DefaultCapacityMinutes is the daily capacity of users who never set one.
+const DefaultCapacityMinutes = 8 * 60
+
+// Rollover modes: what happens to unfinished todos of past days when a new
+// local day starts.
+const (
+	RolloverOff  = "off"
+	RolloverMove = "move"
+	RolloverCopy = "copy"
+)
+
+// Settings are a user's preferences. A user without a user_settings row gets
+// Default().
+type Settings struct {
+	// DailyCapacityMinutes is how much work fits in a day, in minutes.
+	DailyCapacityMinutes int `json:"dailyCapacityMinutes"`
+	// WeekdayCapacity overrides the daily capacity by weekday, keyed "mon"
+	// through "sun". 0 marks a day off.
+	WeekdayCapacity map[string]int `json:"weekdayCapacity"`
+	// Timezone is the IANA name of the user's zone and decides when a new
+	// day starts for rollover.
+	Timezone string `json:"timezone"`
+	// RolloverMode is one of the Rollover* constants.
+	RolloverMode string `json:"rolloverMode"`
+	// LastRolloverDate is the local day of the last rollover. It is kept up
+	// to date by the rollover itself and ignored by Save.
+	LastRolloverDate string `json:"lastRolloverDate,omitempty"`
+}
+
+var weekdays = [...]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func Default() Settings {
+	return Settings{DailyCapacityMinutes: DefaultCapacityMinutes, WeekdayCapacity: map[string]int{}, Timezone: "UTC", RolloverMode: RolloverOff}
+}
+
+// CapacityOn returns the capacity in minutes for the given day.
+func (s Settings) CapacityOn(day time.Time) int {
+	if v, ok := s.WeekdayCapacity[weekdays[day.Weekday()]]; ok {
+		return v
+	}
+	return s.DailyCapacityMinutes
+}
+
+// Location returns the user's time zone, falling back to UTC.
+func (s Settings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Validate checks that all capacities fit in a day, that overrides use known
+// weekday keys, and that the time zone and rollover mode are known.
+func (s Settings) Validate() error {
+	if s.DailyCapacityMinutes < 0 || s.DailyCapacityMinutes > 24*60 {
+		return errors.New("dailyCapacityMinutes must be between 0 and 1440")
+	}
+	for k, v := range s.WeekdayCapacity {
+		if !validWeekday(k) {
+			return fmt.Errorf("weekdayCapacity: unknown weekday %q, use %s", k, strings.Join(weekdays[:], ", "))
+		}
+		if v < 0 || v > 24*60 {
+			return fmt.Errorf("weekdayCapacity.%s must be between 0 and 1440", k)
+		}
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil || s.Timezone == "" || s.Timezone == "Local" {
+		return fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	switch s.RolloverMode {
+	case RolloverOff, RolloverMove, RolloverCopy:
+	default:
+		return fmt.Errorf("rolloverMode must be %s, %s or %s", RolloverOff, RolloverMove, RolloverCopy)
+	}
+	return nil
+}
+
+func validWeekday(k string) bool {
+	for _, d := range weekdays {
+		if d == k {
+			return true
+		}
+	}
+	return false
+}
+
+// Load returns the user's settings, or the defaults when none are saved.
+func Load(ctx context.Context, q db.Querier, userID int64) (Settings, error) {
+	s := Default()
+	var last *string
+	err := q.QueryRow(ctx, "SELECT daily_capacity_minutes, weekday_capacity, timezone, rollover_mode, to_char(last_rollover_date,'YYYY-MM-DD') FROM user_settings WHERE user_id=$1", userID).
+		Scan(&s.DailyCapacityMinutes, &s.WeekdayCapacity, &s.Timezone, &s.RolloverMode, &last)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Default(), nil
+	}
+	if s.WeekdayCapacity == nil {
+		s.WeekdayCapacity = map[string]int{}
+	}
+	if last != nil {
+		s.LastRolloverDate = *last
+	}
+	return s, err
+}
+
+// Save stores the user's settings.
+func Save(ctx context.Context, q db.Querier, userID int64, s Settings) error {
+	_, err := q.Exec(ctx, `INSERT INTO user_settings(user_id, daily_capacity_minutes, weekday_capacity, timezone, rollover_mode) VALUES($1,$2,$3,$4,$5)
+        ON CONFLICT (user_id) DO UPDATE SET daily_capacity_minutes=EXCLUDED.daily_capacity_minutes, weekday_capacity=EXCLUDED.weekday_capacity,
+        timezone=EXCLUDED.timezone, rollover_mode=EXCLUDED.rollover_mode, updated_at=NOW()`,
+		userID, s.DailyCapacityMinutes, s.WeekdayCapacity, s.Timezone, s.RolloverMode)
+	return err
+}
+
+// MarkRolledOver records day as the user's last rollover.
+func MarkRolledOver(ctx context.Context, q db.Querier, userID int64, day string) error {
+	_, err := q.Exec(ctx, `INSERT INTO user_settings(user_id, last_rollover_date) VALUES($1,$2)
+        ON CONFLICT (user_id) DO UPDATE SET last_rollover_date=GREATEST(user_settings.last_rollover_date, EXCLUDED.last_rollover_date)`, userID, day)
+	return err
+}
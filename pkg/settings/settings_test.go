@@ -0,0 +1,44 @@
+package settings
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCapacityOn(t *testing.T) {
+	s := Settings{DailyCapacityMinutes: 420, WeekdayCapacity: map[string]int{"sun": 0, "wed": 240}}
+	cases := map[string]int{
+		"2025-03-02": 0,   // Sunday
+		"2025-03-03": 420, // Monday
+		"2025-03-05": 240, // Wednesday
+	}
+	for date, want := range cases {
+		d, _ := time.Parse("2006-01-02", date)
+		if got := s.CapacityOn(d); got != want {
+			t.Errorf("CapacityOn(%s) = %d, want %d", date, got, want)
+		}
+	}
+	if got := Default().CapacityOn(time.Now()); got != DefaultCapacityMinutes {
+		t.Errorf("default capacity = %d", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Settings{DailyCapacityMinutes: 480, WeekdayCapacity: map[string]int{"sat": 0}, Timezone: "Asia/Shanghai", RolloverMode: RolloverCopy}).Validate(); err != nil {
+		t.Fatalf("valid settings: %v", err)
+	}
+	bad := []Settings{
+		{DailyCapacityMinutes: -1, Timezone: "UTC", RolloverMode: RolloverOff},
+		{DailyCapacityMinutes: 1441, Timezone: "UTC", RolloverMode: RolloverOff},
+		{DailyCapacityMinutes: 480, WeekdayCapacity: map[string]int{"monday": 60}, Timezone: "UTC", RolloverMode: RolloverOff},
+		{DailyCapacityMinutes: 480, WeekdayCapacity: map[string]int{"mon": 2000}, Timezone: "UTC", RolloverMode: RolloverOff},
+		{DailyCapacityMinutes: 480, Timezone: "Mars/Olympus", RolloverMode: RolloverOff},
+		{DailyCapacityMinutes: 480, Timezone: "", RolloverMode: RolloverOff},
+		{DailyCapacityMinutes: 480, Timezone: "UTC", RolloverMode: "sometimes"},
+	}
+	for _, s := range bad {
+		if err := s.Validate(); err == nil {
+			t.Errorf("expected error for %+v", s)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package snooze
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const layout = "2006-01-02"
+
+var (
+	ErrInvalid = errors.New(`unknown snooze target, use YYYY-MM-DD, "tomorrow", "3d", "2w", "next week", "weekend" or a weekday such as "next monday"`)
+	ErrPast    = errors.New("snooze target must be after today")
+)
+
+var relative = regexp.MustCompile(`^\+?(\d{1,3})\s*(d|day|days|w|week|weeks)$`)
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// Parse resolves a snooze target relative to the local day of now and
+// returns it as YYYY-MM-DD. Accepted forms:
+//
+//	2025-03-10         a date
+//	tomorrow
+//	3d, +3 days, 2w    days or weeks from today
+//	next week          the coming Monday
+//	weekend            the coming Saturday
+//	monday, next fri   the next such weekday after today
+//
+// The result is always after today.
+func Parse(spec string, now time.Time) (string, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	s := strings.Join(strings.Fields(strings.ToLower(spec)), " ")
+	var target time.Time
+	switch {
+	case s == "tomorrow":
+		target = today.AddDate(0, 0, 1)
+	case s == "next week":
+		target = next(today, time.Monday)
+	case s == "weekend" || s == "this weekend":
+		target = next(today, time.Saturday)
+	case relative.MatchString(s):
+		m := relative.FindStringSubmatch(s)
+		n, _ := strconv.Atoi(m[1])
+		if strings.HasPrefix(m[2], "w") {
+			n *= 7
+		}
+		target = today.AddDate(0, 0, n)
+	default:
+		if d, ok := weekdays[strings.TrimPrefix(s, "next ")]; ok {
+			target = next(today, d)
+			break
+		}
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return "", ErrInvalid
+		}
+		target = t
+	}
+	if !target.After(today) {
+		return "", ErrPast
+	}
+	return target.Format(layout), nil
+}
+
+// Days returns the day n days after the local day of now.
+func Days(n int, now time.Time) (string, error) {
+	if n < 1 {
+		return "", ErrPast
+	}
+	return Parse(fmt.Sprintf("%dd", n), now)
+}
+
+// next returns the first day after today that falls on d.
+func next(today time.Time, d time.Weekday) time.Time {
+	n := (int(d) - int(today.Weekday()) + 7) % 7
+	if n == 0 {
+		n = 7
+	}
+	return today.AddDate(0, 0, n)
+}
@@ -0,0 +1,46 @@
+package snooze
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// Wednesday 2025-03-05, late evening in UTC+8.
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	now := time.Date(2025, 3, 5, 23, 30, 0, 0, shanghai)
+	cases := map[string]string{
+		"tomorrow":    "2025-03-06",
+		"2d":          "2025-03-07",
+		"+2 days":     "2025-03-07",
+		"1w":          "2025-03-12",
+		"next week":   "2025-03-10",
+		"weekend":     "2025-03-08",
+		"Monday":      "2025-03-10",
+		"next  fri":   "2025-03-07",
+		"wednesday":   "2025-03-12",
+		"2025-04-01":  "2025-04-01",
+		" TOMORROW  ": "2025-03-06",
+	}
+	for spec, want := range cases {
+		got, err := Parse(spec, now)
+		if err != nil || got != want {
+			t.Errorf("Parse(%q) = %q, %v; want %q", spec, got, err, want)
+		}
+	}
+	for _, spec := range []string{"", "later", "0d", "2025-03-05", "2025-02-01", "2025-13-01"} {
+		if _, err := Parse(spec, now); err == nil {
+			t.Errorf("Parse(%q): expected error", spec)
+		}
+	}
+}
+
+func TestDays(t *testing.T) {
+	now := time.Date(2025, 12, 30, 10, 0, 0, 0, time.UTC)
+	if got, err := Days(3, now); err != nil || got != "2026-01-02" {
+		t.Errorf("Days(3) = %q, %v", got, err)
+	}
+	if _, err := Days(0, now); err != ErrPast {
+		t.Errorf("Days(0) = %v", err)
+	}
+}
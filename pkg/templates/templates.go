@@ -0,0 +1,244 @@
+package templates
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/todos"
+	"chronos-task-manager/pkg/validate"
+)
+
+// Template is a reusable todo. Title, Description, Time and subtask titles
+// may contain placeholders that are filled in on instantiation; see Render.
+type Template struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	GroupID     string    `json:"groupId"`
+	Time        string    `json:"time"`
+	Subtasks    []Item    `json:"subtasks"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Item is a subtask of a template.
+type Item struct {
+	Title    string `json:"title"`
+	Children []Item `json:"children,omitempty"`
+}
+
+// MaxItems caps the number of subtasks in a template, counting nested ones.
+const MaxItems = 200
+
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z][A-Za-z0-9_]*)\s*\}\}`)
+
+// Builtins returns the placeholders derived from the target date:
+// date (YYYY-MM-DD), year, month, day, week (ISO week number), weekday.
+func Builtins(date time.Time) map[string]string {
+	_, week := date.ISOWeek()
+	return map[string]string{
+		"date":    date.Format("2006-01-02"),
+		"year":    strconv.Itoa(date.Year()),
+		"month":   fmt.Sprintf("%02d", int(date.Month())),
+		"day":     fmt.Sprintf("%02d", date.Day()),
+		"week":    strconv.Itoa(week),
+		"weekday": date.Weekday().String(),
+	}
+}
+
+// Render replaces every {{name}} in s with vars[name]. Unknown placeholders
+// are an error so that typos do not end up in real todos.
+func Render(s string, vars map[string]string) (string, error) {
+	var missing []string
+	out := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		name := placeholder.FindStringSubmatch(m)[1]
+		v, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+			return m
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("unknown placeholder %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// Validate checks the template before it is saved with the rules of the
+// todos it makes. Placeholders are only checked on instantiation, when the
+// custom values are known, and a time containing one is checked then too.
+// The error is validate.Errors.
+func (t Template) Validate() error {
+	var errs validate.Errors
+	errs.String("name", t.Name, validate.Required)
+	errs.String("title", t.Title, todos.TitleRules...)
+	errs.String("description", t.Description, todos.DescriptionRules...)
+	errs.String("groupId", t.GroupID, todos.GroupRules...)
+	if !placeholder.MatchString(t.Time) {
+		errs.String("time", t.Time, validate.Time)
+	}
+	if n := count(t.Subtasks); n > MaxItems {
+		errs.Add("subtasks", validate.CodeTooLong, fmt.Sprintf("must have at most %d subtasks", MaxItems))
+	} else {
+		checkItems(&errs, "subtasks", t.Subtasks)
+	}
+	return errs.Err()
+}
+
+// Placeholders lists the distinct placeholder names used by the template
+// that are not builtins, sorted.
+func (t Template) Placeholders() []string {
+	seen := map[string]bool{}
+	builtin := Builtins(time.Time{})
+	var walk func(items []Item)
+	scan := func(s string) {
+		for _, m := range placeholder.FindAllStringSubmatch(s, -1) {
+			if _, ok := builtin[m[1]]; !ok {
+				seen[m[1]] = true
+			}
+		}
+	}
+	walk = func(items []Item) {
+		for _, it := range items {
+			scan(it.Title)
+			walk(it.Children)
+		}
+	}
+	scan(t.Title)
+	scan(t.Description)
+	scan(t.Time)
+	walk(t.Subtasks)
+	names := make([]string, 0, len(seen))
+	for k := range seen {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Instantiate renders the template into a todo on date. vars supplies custom
+// placeholders; builtins cannot be overridden.
+func (t Template) Instantiate(date time.Time, vars map[string]string) (todos.Todo, error) {
+	all := map[string]string{}
+	for k, v := range vars {
+		all[k] = v
+	}
+	for k, v := range Builtins(date) {
+		all[k] = v
+	}
+	todo := todos.Todo{Date: date.Format("2006-01-02"), GroupID: t.GroupID, Tags: []string{}}
+	var err error
+	if todo.Title, err = Render(t.Title, all); err != nil {
+		return todo, err
+	}
+	if todo.Description, err = Render(t.Description, all); err != nil {
+		return todo, err
+	}
+	if todo.Time, err = Render(t.Time, all); err != nil {
+		return todo, err
+	}
+	todo.Subtasks, err = renderItems(t.Subtasks, all)
+	return todo, err
+}
+
+func renderItems(items []Item, vars map[string]string) ([]todos.Subtask, error) {
+	out := make([]todos.Subtask, 0, len(items))
+	for _, it := range items {
+		title, err := Render(it.Title, vars)
+		if err != nil {
+			return nil, err
+		}
+		children, err := renderItems(it.Children, vars)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, todos.Subtask{Title: title, Children: children})
+	}
+	return out, nil
+}
+
+func count(items []Item) int {
+	n := len(items)
+	for _, it := range items {
+		n += count(it.Children)
+	}
+	return n
+}
+
+func checkItems(errs *validate.Errors, prefix string, items []Item) {
+	for i, it := range items {
+		name := fmt.Sprintf("%s[%d]", prefix, i)
+		errs.String(name+".title", it.Title, todos.TitleRules...)
+		checkItems(errs, name+".children", it.Children)
+	}
+}
+
+const columns = "id,name,title,description,group_id,time,subtasks,created_at,updated_at"
+
+func scan(row interface{ Scan(...any) error }, t *Template) error {
+	if err := row.Scan(&t.ID, &t.Name, &t.Title, &t.Description, &t.GroupID, &t.Time, &t.Subtasks, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return err
+	}
+	if t.Subtasks == nil {
+		t.Subtasks = []Item{}
+	}
+	return nil
+}
+
+// List returns the user's templates by name.
+func List(ctx context.Context, q db.Querier, userID int64) ([]Template, error) {
+	rows, err := q.Query(ctx, "SELECT "+columns+" FROM todo_templates WHERE user_id=$1 ORDER BY name, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Template{}
+	for rows.Next() {
+		var t Template
+		if err := scan(rows, &t); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// Get returns one template. It returns pgx.ErrNoRows when the user has no
+// template with that id.
+func Get(ctx context.Context, q db.Querier, userID, id int64) (Template, error) {
+	var t Template
+	err := scan(q.QueryRow(ctx, "SELECT "+columns+" FROM todo_templates WHERE user_id=$1 AND id=$2", userID, id), &t)
+	return t, err
+}
+
+// Create stores a new template and returns it as saved.
+func Create(ctx context.Context, q db.Querier, userID int64, t Template) (Template, error) {
+	var out Template
+	err := scan(q.QueryRow(ctx, "INSERT INTO todo_templates(user_id,name,title,description,group_id,time,subtasks) VALUES($1,$2,$3,$4,$5,$6,$7) RETURNING "+columns,
+		userID, t.Name, t.Title, t.Description, t.GroupID, t.Time, items(t.Subtasks)), &out)
+	return out, err
+}
+
+// Update replaces a template. It returns pgx.ErrNoRows when there is no such
+// template.
+func Update(ctx context.Context, q db.Querier, userID int64, t Template) (Template, error) {
+	var out Template
+	err := scan(q.QueryRow(ctx, "UPDATE todo_templates SET name=$3,title=$4,description=$5,group_id=$6,time=$7,subtasks=$8,updated_at=NOW() WHERE user_id=$1 AND id=$2 RETURNING "+columns,
+		userID, t.ID, t.Name, t.Title, t.Description, t.GroupID, t.Time, items(t.Subtasks)), &out)
+	return out, err
+}
+
+func items(list []Item) []Item {
+	if list == nil {
+		return []Item{}
+	}
+	return list
+}
@@ -0,0 +1,89 @@
+package templates
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	vars := map[string]string{"date": "2025-03-03", "version": "1.4"}
+	got, err := Render("Release {{version}} on {{ date }}", vars)
+	if err != nil || got != "Release 1.4 on 2025-03-03" {
+		t.Fatalf("Render = %q, %v", got, err)
+	}
+	if got, _ := Render("no placeholders {here}", vars); got != "no placeholders {here}" {
+		t.Errorf("plain text changed: %q", got)
+	}
+	if _, err := Render("{{verison}} and {{owner}}", vars); err == nil || !strings.Contains(err.Error(), "verison, owner") {
+		t.Errorf("unknown placeholders: %v", err)
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	b := Builtins(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	want := map[string]string{"date": "2025-01-01", "year": "2025", "month": "01", "day": "01", "week": "1", "weekday": "Wednesday"}
+	if !reflect.DeepEqual(b, want) {
+		t.Fatalf("Builtins = %v", b)
+	}
+	// 2024-12-30 belongs to ISO week 1 of 2025.
+	if w := Builtins(time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC))["week"]; w != "1" {
+		t.Errorf("week = %s", w)
+	}
+}
+
+func TestInstantiate(t *testing.T) {
+	tpl := Template{
+		Name:        "Weekly report",
+		Title:       "Weekly report W{{week}}",
+		Description: "For {{team}}",
+		GroupID:     "work",
+		Time:        "17:00",
+		Subtasks: []Item{
+			{Title: "Collect numbers until {{date}}"},
+			{Title: "Draft", Children: []Item{{Title: "Ask {{team}} for input"}}},
+		},
+	}
+	if err := tpl.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := tpl.Placeholders(); !reflect.DeepEqual(got, []string{"team"}) {
+		t.Errorf("Placeholders = %v", got)
+	}
+	date := time.Date(2025, 3, 7, 0, 0, 0, 0, time.UTC)
+	todo, err := tpl.Instantiate(date, map[string]string{"team": "infra", "date": "ignored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo.Title != "Weekly report W10" || todo.Description != "For infra" || todo.Date != "2025-03-07" || todo.GroupID != "work" || todo.Time != "17:00" {
+		t.Errorf("todo = %+v", todo)
+	}
+	if len(todo.Subtasks) != 2 || todo.Subtasks[0].Title != "Collect numbers until 2025-03-07" || todo.Subtasks[1].Children[0].Title != "Ask infra for input" {
+		t.Errorf("subtasks = %+v", todo.Subtasks)
+	}
+	if _, err := tpl.Instantiate(date, nil); err == nil {
+		t.Error("expected missing placeholder error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := []Template{
+		{Title: "x"},
+		{Name: "x"},
+		{Name: "x", Title: "x", Subtasks: []Item{{Title: "ok", Children: []Item{{Title: " "}}}}},
+		{Name: "x", Title: "x", GroupID: "work", Subtasks: make([]Item, MaxItems+1)},
+		{Name: "x", Title: "x", GroupID: "play"},
+		{Name: "x", Title: "x", GroupID: "work", Time: "5pm"},
+		{Name: "x", Title: "x", GroupID: "work", Description: strings.Repeat("d", 5001)},
+	}
+	for i, tpl := range bad {
+		if err := tpl.Validate(); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+	ok := Template{Name: "x", Title: "x", GroupID: "work", Time: "{{start}}"}
+	if err := ok.Validate(); err != nil {
+		t.Errorf("time placeholder rejected: %v", err)
+	}
+}
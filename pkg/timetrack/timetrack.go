@@ -0,0 +1,269 @@
+package timetrack
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/db"
+)
+
+// Entry is one span of tracked time. A running timer is an entry without
+// EndedAt; at most one exists per user.
+type Entry struct {
+	ID        int64      `json:"id"`
+	TodoID    int64      `json:"todoId"`
+	SubtaskID *int64     `json:"subtaskId,omitempty"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	Seconds   int64      `json:"seconds"`
+	Running   bool       `json:"running"`
+	Note      string     `json:"note,omitempty"`
+}
+
+const columns = "id,todo_id,subtask_id,started_at,ended_at,COALESCE(note,'')"
+
+func scan(row pgx.Row, e *Entry) error {
+	if err := row.Scan(&e.ID, &e.TodoID, &e.SubtaskID, &e.StartedAt, &e.EndedAt, &e.Note); err != nil {
+		return err
+	}
+	end := time.Now()
+	if e.EndedAt != nil {
+		end = *e.EndedAt
+	}
+	e.Running = e.EndedAt == nil
+	e.Seconds = int64(end.Sub(e.StartedAt).Seconds())
+	return nil
+}
+
+// List loads the entries matching where (a condition on time_entries using
+// $1.. placeholders), newest first.
+func List(ctx context.Context, q db.Querier, where string, args ...any) ([]Entry, error) {
+	rows, err := q.Query(ctx, "SELECT "+columns+" FROM time_entries WHERE "+where+" ORDER BY started_at DESC, id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Entry{}
+	for rows.Next() {
+		var e Entry
+		if err := scan(rows, &e); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// Get loads one of the user's entries. It returns pgx.ErrNoRows when there is
+// no such entry.
+func Get(ctx context.Context, q db.Querier, userID, id int64) (*Entry, error) {
+	var e Entry
+	if err := scan(q.QueryRow(ctx, "SELECT "+columns+" FROM time_entries WHERE user_id=$1 AND id=$2", userID, id), &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Running returns the user's running timer, or nil when none is running.
+func Running(ctx context.Context, q db.Querier, userID int64) (*Entry, error) {
+	var e Entry
+	err := scan(q.QueryRow(ctx, "SELECT "+columns+" FROM time_entries WHERE user_id=$1 AND ended_at IS NULL", userID), &e)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Stop ends the user's running timer and returns it, or nil when none was
+// running.
+func Stop(ctx context.Context, q db.Querier, userID int64) (*Entry, error) {
+	var e Entry
+	err := scan(q.QueryRow(ctx, "UPDATE time_entries SET ended_at=GREATEST(NOW(), started_at) WHERE user_id=$1 AND ended_at IS NULL RETURNING "+columns, userID), &e)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ValidTarget reports whether time can be logged against the todo, and the
+// subtask when given: both must be live and belong to the user.
+func ValidTarget(ctx context.Context, q db.Querier, userID, todoID int64, subtaskID *int64) (bool, error) {
+	var ok bool
+	err := q.QueryRow(ctx, `SELECT EXISTS(
+        SELECT 1 FROM todos t
+        WHERE t.id=$1 AND t.user_id=$2 AND t.deleted_at IS NULL
+          AND ($3::bigint IS NULL OR EXISTS (SELECT 1 FROM subtasks s WHERE s.id=$3 AND s.todo_id=t.id AND s.deleted_at IS NULL))
+    )`, todoID, userID, subtaskID).Scan(&ok)
+	return ok, err
+}
+
+// Totals returns the tracked seconds per todo for ids, counting running
+// timers up to now.
+func Totals(ctx context.Context, q db.Querier, ids []int64) (map[int64]int64, error) {
+	rows, err := q.Query(ctx, "SELECT todo_id, SUM(EXTRACT(EPOCH FROM COALESCE(ended_at, NOW()) - started_at))::bigint FROM time_entries WHERE todo_id = ANY($1) GROUP BY todo_id", ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	m := map[int64]int64{}
+	for rows.Next() {
+		var id, secs int64
+		if err := rows.Scan(&id, &secs); err != nil {
+			return nil, err
+		}
+		m[id] = secs
+	}
+	return m, rows.Err()
+}
+
+// Report groupings.
+const (
+	ByDay     = "day"
+	ByGroup   = "group"
+	ByProject = "project"
+)
+
+// Span is an entry as the report sees it.
+type Span struct {
+	Start       time.Time
+	End         *time.Time
+	GroupID     string
+	ProjectID   *int64
+	ProjectName string
+}
+
+// Row is one line of a time report.
+type Row struct {
+	Key     string  `json:"key"`
+	Label   string  `json:"label"`
+	Seconds int64   `json:"seconds"`
+	Hours   float64 `json:"hours"`
+}
+
+// LoadSpans returns the user's tracked time on live todos overlapping
+// [from, to).
+func LoadSpans(ctx context.Context, q db.Querier, userID int64, from, to time.Time) ([]Span, error) {
+	rows, err := q.Query(ctx, `
+        SELECT e.started_at, e.ended_at, t.group_id, t.project_id, COALESCE(p.name,'')
+        FROM time_entries e
+        JOIN todos t ON t.id=e.todo_id
+        LEFT JOIN projects p ON p.id=t.project_id
+        WHERE e.user_id=$1 AND t.deleted_at IS NULL
+          AND e.started_at < $3 AND COALESCE(e.ended_at, NOW()) > $2
+    `, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var spans []Span
+	for rows.Next() {
+		var s Span
+		if err := rows.Scan(&s.Start, &s.End, &s.GroupID, &s.ProjectID, &s.ProjectName); err != nil {
+			return nil, err
+		}
+		spans = append(spans, s)
+	}
+	return spans, rows.Err()
+}
+
+// Summarize sums spans clipped to [from, to) by day, group or project. Days
+// are calendar days in from's location, and a span crossing midnight counts
+// towards both days. Running spans end at now.
+func Summarize(spans []Span, by string, from, to, now time.Time) ([]Row, error) {
+	if by != ByDay && by != ByGroup && by != ByProject {
+		return nil, fmt.Errorf("by must be %s, %s or %s", ByDay, ByGroup, ByProject)
+	}
+	loc := from.Location()
+	secs := map[string]float64{}
+	labels := map[string]string{}
+	for _, s := range spans {
+		start, end := s.Start, now
+		if s.End != nil {
+			end = *s.End
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+		switch by {
+		case ByDay:
+			for start.Before(end) {
+				day := start.In(loc)
+				next := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc)
+				stop := end
+				if next.Before(stop) {
+					stop = next
+				}
+				key := day.Format("2006-01-02")
+				secs[key] += stop.Sub(start).Seconds()
+				labels[key] = key
+				start = stop
+			}
+		case ByGroup:
+			secs[s.GroupID] += end.Sub(start).Seconds()
+			labels[s.GroupID] = s.GroupID
+		case ByProject:
+			key, label := "none", "No project"
+			if s.ProjectID != nil {
+				key, label = strconv.FormatInt(*s.ProjectID, 10), s.ProjectName
+			}
+			secs[key] += end.Sub(start).Seconds()
+			labels[key] = label
+		}
+	}
+	rows := make([]Row, 0, len(secs))
+	for k, v := range secs {
+		n := int64(v)
+		rows = append(rows, Row{Key: k, Label: labels[k], Seconds: n, Hours: hours(n)})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if by == ByDay || rows[i].Seconds == rows[j].Seconds {
+			return rows[i].Key < rows[j].Key
+		}
+		return rows[i].Seconds > rows[j].Seconds
+	})
+	return rows, nil
+}
+
+func hours(secs int64) float64 {
+	return float64(secs/36) / 100
+}
+
+// WriteCSV writes rows as CSV with a header line.
+func WriteCSV(w io.Writer, rows []Row) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"key", "label", "seconds", "hours"})
+	for _, r := range rows {
+		cw.Write([]string{cell(r.Key), cell(r.Label), strconv.FormatInt(r.Seconds, 10), strconv.FormatFloat(r.Hours, 'f', 2, 64)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// cell quotes user text that a spreadsheet would otherwise run as a formula.
+func cell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
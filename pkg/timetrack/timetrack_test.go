@@ -0,0 +1,118 @@
+package timetrack
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func at(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func end(s string) *time.Time {
+	t := at(s)
+	return &t
+}
+
+func id(v int64) *int64 { return &v }
+
+func TestSummarizeByDay(t *testing.T) {
+	from, to := at("2025-03-01T00:00:00Z"), at("2025-03-04T00:00:00Z")
+	spans := []Span{
+		// Crosses midnight: 1h on the 1st, 30m on the 2nd.
+		{Start: at("2025-03-01T23:00:00Z"), End: end("2025-03-02T00:30:00Z")},
+		// Starts before the range: only the part from the 1st counts.
+		{Start: at("2025-02-28T23:00:00Z"), End: end("2025-03-01T00:15:00Z")},
+		// Still running at now.
+		{Start: at("2025-03-03T10:00:00Z")},
+	}
+	now := at("2025-03-03T12:00:00Z")
+	rows, err := Summarize(spans, ByDay, from, to, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Row{
+		{Key: "2025-03-01", Label: "2025-03-01", Seconds: 4500, Hours: 1.25},
+		{Key: "2025-03-02", Label: "2025-03-02", Seconds: 1800, Hours: 0.5},
+		{Key: "2025-03-03", Label: "2025-03-03", Seconds: 7200, Hours: 2},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %+v", rows)
+	}
+}
+
+func TestSummarizeByDayInLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, loc)
+	to := from.AddDate(0, 0, 2)
+	// 15:00-17:00 UTC is 23:00-01:00 in UTC+8.
+	spans := []Span{{Start: at("2025-03-01T15:00:00Z"), End: end("2025-03-01T17:00:00Z")}}
+	rows, err := Summarize(spans, ByDay, from, to, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Key != "2025-03-01" || rows[0].Seconds != 3600 || rows[1].Key != "2025-03-02" {
+		t.Fatalf("rows = %+v", rows)
+	}
+}
+
+func TestSummarizeByProjectAndGroup(t *testing.T) {
+	from, to := at("2025-03-01T00:00:00Z"), at("2025-03-02T00:00:00Z")
+	spans := []Span{
+		{Start: at("2025-03-01T09:00:00Z"), End: end("2025-03-01T10:00:00Z"), GroupID: "work", ProjectID: id(7), ProjectName: "Website"},
+		{Start: at("2025-03-01T11:00:00Z"), End: end("2025-03-01T13:00:00Z"), GroupID: "work"},
+		{Start: at("2025-03-01T14:00:00Z"), End: end("2025-03-01T14:30:00Z"), GroupID: "home", ProjectID: id(7), ProjectName: "Website"},
+	}
+	rows, err := Summarize(spans, ByProject, from, to, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Row{
+		{Key: "none", Label: "No project", Seconds: 7200, Hours: 2},
+		{Key: "7", Label: "Website", Seconds: 5400, Hours: 1.5},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("by project = %+v", rows)
+	}
+	rows, _ = Summarize(spans, ByGroup, from, to, to)
+	if len(rows) != 2 || rows[0].Key != "work" || rows[0].Seconds != 10800 {
+		t.Fatalf("by group = %+v", rows)
+	}
+	if _, err := Summarize(spans, "week", from, to, to); err == nil {
+		t.Fatal("expected error for unknown grouping")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, []Row{{Key: "7", Label: "Site, v2", Seconds: 5400, Hours: 1.5}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "key,label,seconds,hours\n7,\"Site, v2\",5400,1.50\n"
+	if buf.String() != want {
+		t.Fatalf("csv = %q", buf.String())
+	}
+}
+
+func TestWriteCSVEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	rows := []Row{
+		{Key: "a", Label: "=HYPERLINK(\"x\")"},
+		{Key: "b", Label: "+1"},
+		{Key: "c", Label: "-1"},
+		{Key: "@d", Label: "plain"},
+	}
+	if err := WriteCSV(&buf, rows); err != nil {
+		t.Fatal(err)
+	}
+	want := "key,label,seconds,hours\na,\"'=HYPERLINK(\"\"x\"\")\",0,0.00\nb,'+1,0,0.00\nc,'-1,0,0.00\n'@d,plain,0,0.00\n"
+	if buf.String() != want {
+		t.Fatalf("csv = %q", buf.String())
+	}
+}
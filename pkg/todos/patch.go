@@ -0,0 +1,228 @@
+package todos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/patch"
+	"chronos-task-manager/pkg/validate"
+)
+
+// Patch is a decoded merge patch for a todo. Fields that may be empty are
+// cleared by null or an empty string; title, date and groupId cannot be
+// cleared.
+type Patch struct {
+	Title           patch.Field[string]
+	Description     patch.Field[string]
+	Date            patch.Field[string]
+	Time            patch.Field[string]
+	GroupID         patch.Field[string]
+	Tags            patch.Field[[]string]
+	ProjectID       patch.Field[int64]
+	EstimateMinutes patch.Field[int]
+	Deadline        patch.Field[string]
+	DeferUntil      patch.Field[string]
+	CustomFields    patch.Field[map[string]interface{}]
+	Subtasks        patch.Field[[]Subtask]
+}
+
+// DecodePatch reads and validates a merge patch for a todo with the same
+// rules as Validate. The error is validate.Errors listing every invalid
+// member.
+func DecodePatch(doc map[string]json.RawMessage) (*Patch, error) {
+	p := &Patch{}
+	errs := patch.Decode(doc, map[string]interface{}{
+		"title":           &p.Title,
+		"description":     &p.Description,
+		"date":            &p.Date,
+		"time":            &p.Time,
+		"groupId":         &p.GroupID,
+		"tags":            &p.Tags,
+		"projectId":       &p.ProjectID,
+		"estimateMinutes": &p.EstimateMinutes,
+		"deadline":        &p.Deadline,
+		"deferUntil":      &p.DeferUntil,
+		"customFields":    &p.CustomFields,
+		"subtasks":        &p.Subtasks,
+	})
+	// bad holds the members that failed to decode; they are not checked
+	// any further.
+	bad := errs.Has
+	// str checks a string member. An empty string counts as null, which
+	// clears the field when it is optional.
+	str := func(name string, f *patch.Field[string], optional bool, rules ...validate.Rule) {
+		if bad(name) || !f.Set {
+			return
+		}
+		if f.Null || f.Value == "" {
+			f.Null = true
+			if !optional {
+				errs.Add(name, validate.CodeRequired, "cannot be cleared")
+			}
+			return
+		}
+		errs.String(name, f.Value, rules...)
+	}
+	p.Title.Value = strings.TrimSpace(p.Title.Value)
+	str("title", &p.Title, false, TitleRules...)
+	str("description", &p.Description, true, DescriptionRules...)
+	str("date", &p.Date, false, validate.Date)
+	str("time", &p.Time, true, validate.Time)
+	str("groupId", &p.GroupID, false, GroupRules...)
+	str("deadline", &p.Deadline, true, validate.Date)
+	str("deferUntil", &p.DeferUntil, true, validate.Date)
+	if !bad("tags") && p.Tags.Set {
+		tags := []string{}
+		for _, t := range p.Tags.Value {
+			if t = strings.TrimSpace(t); t != "" {
+				tags = append(tags, t)
+			}
+		}
+		p.Tags.Null, p.Tags.Value = false, tags
+		checkTags(&errs, tags)
+	}
+	if !bad("projectId") && p.ProjectID.Ptr() != nil && p.ProjectID.Value <= 0 {
+		errs.Add("projectId", validate.CodeRange, "must be a positive id")
+	}
+	if !bad("estimateMinutes") && p.EstimateMinutes.Ptr() != nil {
+		errs.Int("estimateMinutes", int64(p.EstimateMinutes.Value), 0, MaxEstimateMinutes)
+	}
+	if !bad("subtasks") && p.Subtasks.Set {
+		// null empties the checklist.
+		if p.Subtasks.Null {
+			p.Subtasks.Null, p.Subtasks.Value = false, []Subtask{}
+		}
+		checkSubtasks(&errs, "subtasks", p.Subtasks.Value)
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Document returns the members of t that a patch can change, in the form
+// a JSON Patch is applied to. Unset optional fields are null.
+func (t *Todo) Document() (map[string]interface{}, error) {
+	doc := struct {
+		Title           string                 `json:"title"`
+		Description     *string                `json:"description"`
+		Date            string                 `json:"date"`
+		Time            *string                `json:"time"`
+		GroupID         string                 `json:"groupId"`
+		Tags            []string               `json:"tags"`
+		ProjectID       *int64                 `json:"projectId"`
+		EstimateMinutes *int                   `json:"estimateMinutes"`
+		Deadline        *string                `json:"deadline"`
+		DeferUntil      *string                `json:"deferUntil"`
+		CustomFields    map[string]interface{} `json:"customFields"`
+		Subtasks        []Subtask              `json:"subtasks"`
+	}{
+		Title:           t.Title,
+		Date:            t.Date,
+		GroupID:         t.GroupID,
+		Tags:            t.Tags,
+		ProjectID:       t.ProjectID,
+		EstimateMinutes: t.EstimateMinutes,
+		Deadline:        t.Deadline,
+		DeferUntil:      t.DeferUntil,
+		CustomFields:    t.CustomFields,
+		Subtasks:        t.Subtasks,
+	}
+	if t.Description != "" {
+		doc.Description = &t.Description
+	}
+	if t.Time != "" {
+		doc.Time = &t.Time
+	}
+	if doc.Tags == nil {
+		doc.Tags = []string{}
+	}
+	if doc.CustomFields == nil {
+		doc.CustomFields = map[string]interface{}{}
+	}
+	if doc.Subtasks == nil {
+		doc.Subtasks = []Subtask{}
+	}
+	return patch.Document(doc)
+}
+
+// Update writes the fields set in p to todo id and returns the new version.
+// Custom fields replace the stored values as a whole, so the caller merges
+// and checks them first; subtasks are left to PlanSubtasks.
+func Update(ctx context.Context, q db.Querier, userID, id int64, p *Patch) (int64, error) {
+	args := []interface{}{userID, id}
+	var sets []string
+	set := func(f bool, col string, v interface{}) {
+		if f {
+			args = append(args, v)
+			sets = append(sets, fmt.Sprintf(col, len(args)))
+		}
+	}
+	set(p.Title.Set, "title=$%d", p.Title.Value)
+	set(p.Description.Set, "description=$%d", p.Description.Ptr())
+	set(p.Date.Set, "date=$%d::date", p.Date.Value)
+	set(p.Time.Set, "time=$%d", p.Time.Ptr())
+	set(p.GroupID.Set, "group_id=$%d", p.GroupID.Value)
+	set(p.Tags.Set, "tags=$%d", p.Tags.Value)
+	set(p.ProjectID.Set, "project_id=$%d", p.ProjectID.Ptr())
+	set(p.EstimateMinutes.Set, "estimate_minutes=$%d", p.EstimateMinutes.Ptr())
+	set(p.Deadline.Set, "deadline=$%d::date", p.Deadline.Ptr())
+	set(p.DeferUntil.Set, "defer_until=$%d::date", p.DeferUntil.Ptr())
+	set(p.CustomFields.Set, "custom_fields=$%d", p.CustomFields.Value)
+	if len(sets) == 0 {
+		// Still bump the version: a subtask-only patch changes the todo too.
+		sets = []string{"title=title"}
+	}
+	var version int64
+	err := q.QueryRow(ctx, "UPDATE todos SET "+strings.Join(sets, ", ")+" WHERE user_id=$1 AND id=$2 AND deleted_at IS NULL RETURNING version", args...).Scan(&version)
+	return version, err
+}
+
+// SubtaskPatch is a decoded merge patch for a subtask. A null parentId moves
+// the subtask to the top level.
+type SubtaskPatch struct {
+	Title    patch.Field[string]
+	ParentID patch.Field[int64]
+	Position patch.Field[int]
+}
+
+// DecodeSubtaskPatch reads and validates a merge patch for a subtask.
+func DecodeSubtaskPatch(doc map[string]json.RawMessage) (*SubtaskPatch, error) {
+	p := &SubtaskPatch{}
+	errs := patch.Decode(doc, map[string]interface{}{
+		"title":    &p.Title,
+		"parentId": &p.ParentID,
+		"position": &p.Position,
+	})
+	bad := errs.Has
+	if !bad("title") && p.Title.Set {
+		p.Title.Value = strings.TrimSpace(p.Title.Value)
+		if p.Title.Null {
+			errs.Add("title", validate.CodeRequired, "cannot be cleared")
+		} else {
+			errs.String("title", p.Title.Value, TitleRules...)
+		}
+	}
+	if !bad("parentId") && p.ParentID.Ptr() != nil && p.ParentID.Value <= 0 {
+		errs.Add("parentId", validate.CodeRange, "must be a positive id")
+	}
+	if !bad("position") && p.Position.Set && (p.Position.Null || p.Position.Value < 0) {
+		errs.Add("position", validate.CodeRange, "must be a non-negative integer")
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Document returns the members of st that a patch can change.
+func (st *Subtask) Document() (map[string]interface{}, error) {
+	return patch.Document(struct {
+		Title    string `json:"title"`
+		ParentID *int64 `json:"parentId"`
+		Position int    `json:"position"`
+	}{st.Title, st.ParentID, st.Position})
+}
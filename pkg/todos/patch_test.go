@@ -0,0 +1,122 @@
+package todos
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"chronos-task-manager/pkg/patch"
+	"chronos-task-manager/pkg/validate"
+)
+
+func decodeDoc(t *testing.T, s string) map[string]json.RawMessage {
+	t.Helper()
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestDecodePatch(t *testing.T) {
+	p, err := DecodePatch(decodeDoc(t, `{"title":" Report ","time":"","description":null,"tags":[" a ",""],"deadline":null,"projectId":3,"subtasks":null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Title.Value != "Report" {
+		t.Errorf("title = %q", p.Title.Value)
+	}
+	if !p.Time.Set || p.Time.Ptr() != nil {
+		t.Errorf("empty time should clear it: %+v", p.Time)
+	}
+	if !p.Description.Null || !p.Deadline.Null {
+		t.Errorf("null should clear: %+v %+v", p.Description, p.Deadline)
+	}
+	if !reflect.DeepEqual(p.Tags.Value, []string{"a"}) {
+		t.Errorf("tags = %v", p.Tags.Value)
+	}
+	if p.Date.Set || p.GroupID.Set || p.EstimateMinutes.Set {
+		t.Error("absent members should not be set")
+	}
+	if *p.ProjectID.Ptr() != 3 {
+		t.Errorf("projectId = %+v", p.ProjectID)
+	}
+	if !p.Subtasks.Set || p.Subtasks.Null || p.Subtasks.Value == nil || len(p.Subtasks.Value) != 0 {
+		t.Errorf("null subtasks should empty the list: %+v", p.Subtasks)
+	}
+}
+
+func TestDecodePatchErrors(t *testing.T) {
+	_, err := DecodePatch(decodeDoc(t, `{"title":null,"date":"2025-13-01","groupId":"","time":"25:00","estimateMinutes":1.5,"projectId":0,"deferUntil":"soon","tags":"x","done":true}`))
+	var errs validate.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v", err)
+	}
+	want := validate.Errors{
+		{Field: "date", Code: validate.CodeFormat, Message: "must be YYYY-MM-DD"},
+		{Field: "deferUntil", Code: validate.CodeFormat, Message: "must be YYYY-MM-DD"},
+		{Field: "done", Code: validate.CodeUnknownField, Message: "unknown field"},
+		{Field: "estimateMinutes", Code: validate.CodeType, Message: "must be an integer"},
+		{Field: "groupId", Code: validate.CodeRequired, Message: "cannot be cleared"},
+		{Field: "projectId", Code: validate.CodeRange, Message: "must be a positive id"},
+		{Field: "tags", Code: validate.CodeType, Message: "must be an array"},
+		{Field: "time", Code: validate.CodeFormat, Message: "must be HH:MM"},
+		{Field: "title", Code: validate.CodeRequired, Message: "cannot be cleared"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("errors = %#v", errs)
+	}
+}
+
+func TestDecodeSubtaskPatch(t *testing.T) {
+	p, err := DecodeSubtaskPatch(decodeDoc(t, `{"parentId":null,"position":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.ParentID.Set || p.ParentID.Ptr() != nil || *p.Position.Ptr() != 2 || p.Title.Set {
+		t.Errorf("patch = %+v", p)
+	}
+	_, err = DecodeSubtaskPatch(decodeDoc(t, `{"title":"  ","position":-1,"parentId":"x"}`))
+	want := validate.Errors{
+		{Field: "parentId", Code: validate.CodeType, Message: "must be an integer"},
+		{Field: "position", Code: validate.CodeRange, Message: "must be a non-negative integer"},
+		{Field: "title", Code: validate.CodeRequired, Message: "is required"},
+	}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("errors = %#v", err)
+	}
+}
+
+func TestDocument(t *testing.T) {
+	pid := int64(4)
+	todo := &Todo{Title: "a", Date: "2025-01-02", GroupID: "work", ProjectID: &pid, Subtasks: []Subtask{{ID: 9, Title: "s"}}}
+	doc, err := todo.Document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"description", "time", "deadline", "deferUntil", "estimateMinutes"} {
+		if v, ok := doc[k]; !ok || v != nil {
+			t.Errorf("%s = %v, want null", k, v)
+		}
+	}
+	if doc["projectId"] != 4.0 || len(doc["subtasks"].([]interface{})) != 1 {
+		t.Errorf("doc = %v", doc)
+	}
+	// A JSON Patch applied to the document round-trips into a merge patch.
+	next, err := patch.Apply(doc, []patch.Op{{Op: "replace", Path: "/time", Value: json.RawMessage(`"09:30"`)}, {Op: "remove", Path: "/projectId"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := patch.Raw(patch.Diff(doc, next))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := DecodePatch(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Time.Value != "09:30" || !p.ProjectID.Null || p.Title.Set || p.Subtasks.Set {
+		t.Errorf("patch = %+v", p)
+	}
+}
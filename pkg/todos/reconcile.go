@@ -0,0 +1,145 @@
+package todos
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"chronos-task-manager/pkg/db"
+)
+
+// MaxSubtasks bounds a full subtask list sent with a todo, nested subtasks
+// included.
+const MaxSubtasks = 500
+
+// SubtaskPlan brings a todo's live subtasks in line with a desired tree.
+// Nodes with an id keep it and are updated in place; nodes without one are
+// created; live subtasks missing from the tree are trashed.
+type SubtaskPlan struct {
+	nodes   []Subtask
+	current map[int64]Subtask
+	// Update lists the existing subtasks whose title, completion, parent or
+	// position changes; Delete the roots of the branches to trash. Callers
+	// snapshot them before Apply to record history.
+	Update []int64
+	Delete []int64
+}
+
+// PlanSubtasks compares the live subtasks of a todo (flat) with the desired
+// tree. Titles are trimmed and must not be empty, and ids must belong to the
+// todo and appear once.
+func PlanSubtasks(flat []Subtask, nodes []Subtask) (*SubtaskPlan, error) {
+	if n := Size(nodes); n > MaxSubtasks {
+		return nil, fmt.Errorf("at most %d subtasks", MaxSubtasks)
+	}
+	// Subtasks under a trashed parent are not part of the tree the client
+	// sees, so they are left alone.
+	p := &SubtaskPlan{nodes: nodes, current: make(map[int64]Subtask, len(flat))}
+	var visible func(list []Subtask)
+	visible = func(list []Subtask) {
+		for _, st := range list {
+			p.current[st.ID] = st
+			visible(st.Children)
+		}
+	}
+	visible(BuildTree(flat))
+	seen := map[int64]bool{}
+	// fresh is set below a new node, whose children always move.
+	var walk func(list []Subtask, parent *int64, fresh bool) error
+	walk = func(list []Subtask, parent *int64, fresh bool) error {
+		for i := range list {
+			st := &list[i]
+			st.Title = strings.TrimSpace(st.Title)
+			if st.Title == "" {
+				return fmt.Errorf("every subtask needs a title")
+			}
+			if st.ID != 0 {
+				cur, ok := p.current[st.ID]
+				if !ok {
+					return fmt.Errorf("subtask %d does not belong to this todo", st.ID)
+				}
+				if seen[st.ID] {
+					return fmt.Errorf("subtask %d appears more than once", st.ID)
+				}
+				seen[st.ID] = true
+				if fresh || cur.Title != st.Title || cur.Completed != st.Completed || cur.Position != i || !sameParent(cur.ParentID, parent) {
+					p.Update = append(p.Update, st.ID)
+				}
+			}
+			if err := walk(st.Children, &st.ID, st.ID == 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(nodes, nil, false); err != nil {
+		return nil, err
+	}
+	for _, st := range flat {
+		if _, ok := p.current[st.ID]; !ok || seen[st.ID] {
+			continue
+		}
+		// Only trash the top of each removed branch; the rest follows.
+		if st.ParentID != nil && !seen[*st.ParentID] {
+			continue
+		}
+		p.Delete = append(p.Delete, st.ID)
+	}
+	return p, nil
+}
+
+func sameParent(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// Apply writes the plan: existing subtasks are moved and updated and new ones
+// inserted top-down, so every parent exists before its children, then the
+// removed branches are trashed through trash. It fills in the ids of new
+// nodes and returns the resulting tree and the ids it created.
+func (p *SubtaskPlan) Apply(ctx context.Context, q db.Querier, todoID int64, trash func(id int64) error) ([]Subtask, []int64, error) {
+	update := make(map[int64]bool, len(p.Update))
+	for _, id := range p.Update {
+		update[id] = true
+	}
+	var created []int64
+	var walk func(list []Subtask, parent *int64) error
+	walk = func(list []Subtask, parent *int64) error {
+		for i := range list {
+			st := &list[i]
+			st.ParentID = parent
+			st.Position = i
+			switch {
+			case st.ID == 0:
+				if err := insertSubtask(ctx, q, todoID, parent, i, st); err != nil {
+					return err
+				}
+				created = append(created, st.ID)
+			case update[st.ID]:
+				err := q.QueryRow(ctx, "UPDATE subtasks SET title=$2, parent_id=$3, position=$4, completed=$5, completed_at=CASE WHEN $5 THEN COALESCE(completed_at,NOW()) END WHERE id=$1 RETURNING completed_at,version",
+					st.ID, st.Title, parent, i, st.Completed).Scan(&st.CompletedAt, &st.Version)
+				if err != nil {
+					return err
+				}
+			default:
+				cur := p.current[st.ID]
+				st.CompletedAt, st.Version = cur.CompletedAt, cur.Version
+			}
+			if err := walk(st.Children, &st.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(p.nodes, nil); err != nil {
+		return nil, nil, err
+	}
+	for _, id := range p.Delete {
+		if err := trash(id); err != nil {
+			return nil, nil, err
+		}
+	}
+	return p.nodes, created, nil
+}
@@ -0,0 +1,72 @@
+package todos
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func titled(list []Subtask) []Subtask {
+	for i := range list {
+		list[i].Title = "t"
+	}
+	return list
+}
+
+func TestPlanSubtasks(t *testing.T) {
+	flat := titled(sample())
+	flat[1].Position, flat[2].Position, flat[4].Position, flat[5].Position = 0, 1, 1, 1
+	// Keep 1 with 3 renamed and 2 dropped, move 4 to the top level under a
+	// new node, drop 6 and add a new top-level node.
+	nodes := []Subtask{
+		{ID: 1, Title: "t", Children: []Subtask{
+			{ID: 3, Title: " renamed ", Completed: true},
+		}},
+		{Title: "new", Children: []Subtask{{ID: 4, Title: "t"}}},
+	}
+	p, err := PlanSubtasks(flat, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.Update, []int64{3, 4}) {
+		t.Errorf("Update = %v", p.Update)
+	}
+	if !reflect.DeepEqual(p.Delete, []int64{2, 6}) {
+		t.Errorf("Delete = %v", p.Delete)
+	}
+	if nodes[0].Children[0].Title != "renamed" {
+		t.Errorf("title not trimmed: %q", nodes[0].Children[0].Title)
+	}
+}
+
+func TestPlanSubtasksUnchanged(t *testing.T) {
+	flat := []Subtask{{ID: 1, Title: "a"}, {ID: 2, Title: "b", ParentID: ptr(1)}}
+	p, err := PlanSubtasks(flat, []Subtask{{ID: 1, Title: "a", Children: []Subtask{{ID: 2, Title: "b"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Update) != 0 || len(p.Delete) != 0 {
+		t.Errorf("plan = %+v", p)
+	}
+	// Everything removed: only the root is trashed.
+	p, _ = PlanSubtasks(flat, nil)
+	if !reflect.DeepEqual(p.Delete, []int64{1}) {
+		t.Errorf("Delete = %v", p.Delete)
+	}
+}
+
+func TestPlanSubtasksErrors(t *testing.T) {
+	flat := []Subtask{{ID: 1, Title: "a"}, {ID: 7, ParentID: ptr(99), Title: "orphan"}}
+	cases := map[string][]Subtask{
+		"does not belong":  {{ID: 5, Title: "x"}},
+		"more than once":   {{ID: 1, Title: "a"}, {ID: 1, Title: "a"}},
+		"needs a title":    {{Title: "  "}},
+		"does not belong ": {{ID: 7, Title: "orphan"}},
+	}
+	for want, nodes := range cases {
+		_, err := PlanSubtasks(flat, nodes)
+		if err == nil || !strings.Contains(err.Error(), strings.TrimSpace(want)) {
+			t.Errorf("PlanSubtasks(%+v) = %v, want %q", nodes, err, want)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package todos
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"chronos-task-manager/pkg/comments"
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/timetrack"
+)
+
+type Todo struct {
+	ID              int64                  `json:"id"`
+	Title           string                 `json:"title"`
+	Description     string                 `json:"description,omitempty"`
+	Date            string                 `json:"date"`
+	Deadline        *string                `json:"deadline,omitempty"`
+	DeferUntil      *string                `json:"deferUntil,omitempty"`
+	Time            string                 `json:"time,omitempty"`
+	GroupID         string                 `json:"groupId"`
+	ProjectID       *int64                 `json:"projectId,omitempty"`
+	EstimateMinutes *int                   `json:"estimateMinutes,omitempty"`
+	Completed       bool                   `json:"completed"`
+	CompletedAt     *time.Time             `json:"completedAt,omitempty"`
+	Tags            []string               `json:"tags"`
+	CustomFields    map[string]interface{} `json:"customFields,omitempty"`
+	Version         int64                  `json:"version"`
+	TrackedSeconds  int64                  `json:"trackedSeconds"`
+	CommentCount    int                    `json:"commentCount"`
+	RolloverCount   int                    `json:"rolloverCount"`
+	RolledOverTo    *int64                 `json:"rolledOverTo,omitempty"`
+	PromotedFrom    *int64                 `json:"promotedFrom,omitempty"`
+	Blocked         bool                   `json:"blocked"`
+	BlockedBy       []int64                `json:"blockedBy,omitempty"`
+	Subtasks        []Subtask              `json:"subtasks,omitempty"`
+}
+
+type Subtask struct {
+	ID          int64      `json:"id"`
+	ParentID    *int64     `json:"parentId,omitempty"`
+	Position    int        `json:"position"`
+	Title       string     `json:"title"`
+	Completed   bool       `json:"completed"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	Version     int64      `json:"version"`
+	Children    []Subtask  `json:"children,omitempty"`
+}
+
+// columns matches the Scan order in scanTodo.
+const columns = "id,title,COALESCE(description,''),to_char(date,'YYYY-MM-DD'),to_char(deadline,'YYYY-MM-DD'),to_char(defer_until,'YYYY-MM-DD'),COALESCE(time,''),group_id,project_id,estimate_minutes,completed,completed_at,tags,custom_fields,version,rollover_count,rolled_over_to,promoted_from"
+
+func scanTodo(row pgx.Row, t *Todo) error {
+	return row.Scan(&t.ID, &t.Title, &t.Description, &t.Date, &t.Deadline, &t.DeferUntil, &t.Time, &t.GroupID, &t.ProjectID, &t.EstimateMinutes, &t.Completed, &t.CompletedAt, &t.Tags, &t.CustomFields, &t.Version, &t.RolloverCount, &t.RolledOverTo, &t.PromotedFrom)
+}
+
+// subtaskColumns matches the Scan order in scanSubtask.
+const subtaskColumns = "id,todo_id,parent_id,position,title,completed,completed_at,version"
+
+func scanSubtask(row pgx.Row, st *Subtask, todoID *int64) error {
+	return row.Scan(&st.ID, todoID, &st.ParentID, &st.Position, &st.Title, &st.Completed, &st.CompletedAt, &st.Version)
+}
+
+// Get loads one live todo with its subtasks. It returns pgx.ErrNoRows when the
+// todo does not exist, is in the trash or belongs to another user.
+func Get(ctx context.Context, q db.Querier, userID, id int64) (*Todo, error) {
+	var t Todo
+	if err := scanTodo(q.QueryRow(ctx, "SELECT "+columns+" FROM todos WHERE user_id=$1 AND id=$2 AND deleted_at IS NULL", userID, id), &t); err != nil {
+		return nil, err
+	}
+	list := []Todo{t}
+	if err := attach(ctx, q, list); err != nil {
+		return nil, err
+	}
+	return &list[0], nil
+}
+
+// List loads live todos matching where (a condition on the todos table using
+// $1.. placeholders for args) with their subtasks. tail is appended after the
+// WHERE clause and carries ORDER BY and, when paginating, LIMIT.
+func List(ctx context.Context, q db.Querier, where, tail string, args ...any) ([]Todo, error) {
+	rows, err := q.Query(ctx, "SELECT "+columns+" FROM todos WHERE deleted_at IS NULL AND "+where+" "+tail, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Todo{}
+	for rows.Next() {
+		var t Todo
+		if err := scanTodo(rows, &t); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return list, attach(ctx, q, list)
+}
+
+func attach(ctx context.Context, q db.Querier, list []Todo) error {
+	if err := LoadSubtasks(ctx, q, list); err != nil {
+		return err
+	}
+	if err := loadTotals(ctx, q, list); err != nil {
+		return err
+	}
+	return loadBlockers(ctx, q, list)
+}
+
+// loadTotals fills in the tracked time and comment count of every todo.
+func loadTotals(ctx context.Context, q db.Querier, list []Todo) error {
+	if len(list) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(list))
+	for i := range list {
+		ids = append(ids, list[i].ID)
+	}
+	tracked, err := timetrack.Totals(ctx, q, ids)
+	if err != nil {
+		return err
+	}
+	counts, err := comments.Counts(ctx, q, ids)
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		list[i].TrackedSeconds = tracked[list[i].ID]
+		list[i].CommentCount = counts[list[i].ID]
+	}
+	return nil
+}
+
+// Count returns how many live todos match where.
+func Count(ctx context.Context, q db.Querier, where string, args ...any) (int64, error) {
+	var n int64
+	err := q.QueryRow(ctx, "SELECT COUNT(*) FROM todos WHERE deleted_at IS NULL AND "+where, args...).Scan(&n)
+	return n, err
+}
+
+// LoadSubtasks fills in the live subtasks of every todo in list as a tree.
+func LoadSubtasks(ctx context.Context, q db.Querier, list []Todo) error {
+	if len(list) == 0 {
+		return nil
+	}
+	index := make(map[int64]int, len(list))
+	ids := make([]int64, 0, len(list))
+	for i := range list {
+		index[list[i].ID] = i
+		ids = append(ids, list[i].ID)
+	}
+	rows, err := q.Query(ctx, "SELECT "+subtaskColumns+" FROM subtasks WHERE todo_id = ANY($1) AND deleted_at IS NULL ORDER BY position, id", ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var st Subtask
+		var tid int64
+		if err := scanSubtask(rows, &st, &tid); err != nil {
+			return err
+		}
+		t := &list[index[tid]]
+		t.Subtasks = append(t.Subtasks, st)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range list {
+		list[i].Subtasks = BuildTree(list[i].Subtasks)
+	}
+	return nil
+}
+
+// GetSubtask loads one live subtask of a live todo owned by userID.
+func GetSubtask(ctx context.Context, q db.Querier, userID, id int64) (*Subtask, error) {
+	var st Subtask
+	var tid int64
+	err := scanSubtask(q.QueryRow(ctx, "SELECT s."+strings.ReplaceAll(subtaskColumns, ",", ",s.")+" FROM subtasks s JOIN todos t ON t.id=s.todo_id WHERE s.id=$1 AND t.user_id=$2 AND s.deleted_at IS NULL AND t.deleted_at IS NULL", id, userID), &st, &tid)
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// OpenBlockers returns, for each of ids that is blocked, the ids of the live
+// todos blocking it that are not completed yet.
+func OpenBlockers(ctx context.Context, q db.Querier, ids []int64) (map[int64][]int64, error) {
+	rows, err := q.Query(ctx, "SELECT d.todo_id,d.blocked_by FROM todo_dependencies d JOIN todos b ON b.id=d.blocked_by WHERE d.todo_id = ANY($1) AND NOT b.completed AND b.deleted_at IS NULL ORDER BY d.blocked_by", ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	m := map[int64][]int64{}
+	for rows.Next() {
+		var id, blocker int64
+		if err := rows.Scan(&id, &blocker); err != nil {
+			return nil, err
+		}
+		m[id] = append(m[id], blocker)
+	}
+	return m, rows.Err()
+}
+
+func loadBlockers(ctx context.Context, q db.Querier, list []Todo) error {
+	if len(list) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(list))
+	for i := range list {
+		ids = append(ids, list[i].ID)
+	}
+	m, err := OpenBlockers(ctx, q, ids)
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		list[i].BlockedBy = m[list[i].ID]
+		list[i].Blocked = len(list[i].BlockedBy) > 0
+	}
+	return nil
+}
+
+// Insert creates t for the user together with its subtask tree and sets the
+// ids and version on t. Subtasks are positioned in the order given. It is
+// the single insert path for new todos; callers record the history.
+func Insert(ctx context.Context, q db.Querier, userID int64, t *Todo) error {
+	if t.Tags == nil {
+		t.Tags = []string{}
+	}
+	if t.CustomFields == nil {
+		t.CustomFields = map[string]interface{}{}
+	}
+	err := q.QueryRow(ctx, "INSERT INTO todos(user_id,title,description,date,time,group_id,completed,tags,project_id,estimate_minutes,deadline,defer_until,custom_fields,promoted_from) VALUES($1,$2,$3,$4,$5,$6,false,$7,$8,$9,$10::date,$11::date,$12,$13) RETURNING id,version",
+		userID, t.Title, t.Description, t.Date, t.Time, t.GroupID, t.Tags, t.ProjectID, t.EstimateMinutes, t.Deadline, t.DeferUntil, t.CustomFields, t.PromotedFrom).Scan(&t.ID, &t.Version)
+	if err != nil {
+		return err
+	}
+	t.Completed = false
+	t.CompletedAt = nil
+	return InsertSubtasks(ctx, q, t.ID, nil, t.Subtasks)
+}
+
+// InsertSubtasks adds nodes and their children under parentID (nil for the
+// top level) and fills in the new ids and positions. A completed subtask
+// keeps its CompletedAt, or is stamped now when it has none.
+func InsertSubtasks(ctx context.Context, q db.Querier, todoID int64, parentID *int64, nodes []Subtask) error {
+	for i := range nodes {
+		if err := InsertBranch(ctx, q, todoID, parentID, i, &nodes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertBranch adds st at position under parentID, followed by its
+// children. Making room among the siblings is up to the caller, see Place.
+func InsertBranch(ctx context.Context, q db.Querier, todoID int64, parentID *int64, position int, st *Subtask) error {
+	if err := insertSubtask(ctx, q, todoID, parentID, position, st); err != nil {
+		return err
+	}
+	return InsertSubtasks(ctx, q, todoID, &st.ID, st.Children)
+}
+
+// insertSubtask adds st alone, without its children.
+func insertSubtask(ctx context.Context, q db.Querier, todoID int64, parentID *int64, position int, st *Subtask) error {
+	st.ParentID = parentID
+	st.Position = position
+	return q.QueryRow(ctx, "INSERT INTO subtasks(todo_id,parent_id,position,title,completed,completed_at) VALUES($1,$2,$3,$4,$5,CASE WHEN $5 THEN COALESCE($6,NOW()) END) RETURNING id,completed_at,version",
+		todoID, parentID, position, st.Title, st.Completed, st.CompletedAt).Scan(&st.ID, &st.CompletedAt, &st.Version)
+}
+
+// Place makes room for a subtask among the live children of parent and
+// returns the position to store; without a position it goes last. self is
+// left out when an existing subtask is being moved.
+func Place(ctx context.Context, q db.Querier, todoID int64, parent *int64, position *int, self int64) (int, error) {
+	if position == nil {
+		var next int
+		err := q.QueryRow(ctx, "SELECT COALESCE(MAX(position)+1, 0) FROM subtasks WHERE todo_id=$1 AND parent_id IS NOT DISTINCT FROM $2 AND id<>$3 AND deleted_at IS NULL", todoID, parent, self).Scan(&next)
+		return next, err
+	}
+	_, err := q.Exec(ctx, "UPDATE subtasks SET position=position+1 WHERE todo_id=$1 AND parent_id IS NOT DISTINCT FROM $2 AND id<>$3 AND position>=$4 AND deleted_at IS NULL", todoID, parent, self, *position)
+	return *position, err
+}
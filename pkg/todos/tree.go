@@ -0,0 +1,190 @@
+package todos
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"chronos-task-manager/pkg/db"
+)
+
+// BuildTree nests a todo's flat subtask list under their parents, keeping the
+// order of flat among siblings. Subtasks whose parent is not in flat (because
+// it is in the trash) are dropped together with their branch.
+func BuildTree(flat []Subtask) []Subtask {
+	children := map[int64][]Subtask{}
+	present := make(map[int64]bool, len(flat))
+	for _, st := range flat {
+		present[st.ID] = true
+	}
+	var roots []Subtask
+	for _, st := range flat {
+		switch {
+		case st.ParentID == nil:
+			roots = append(roots, st)
+		case present[*st.ParentID]:
+			children[*st.ParentID] = append(children[*st.ParentID], st)
+		}
+	}
+	var fill func(list []Subtask) []Subtask
+	fill = func(list []Subtask) []Subtask {
+		for i := range list {
+			if kids, ok := children[list[i].ID]; ok {
+				list[i].Children = fill(kids)
+			}
+		}
+		return list
+	}
+	return fill(roots)
+}
+
+// Find returns the subtask id in tree with its children, or nil.
+func Find(tree []Subtask, id int64) *Subtask {
+	for i := range tree {
+		if tree[i].ID == id {
+			return &tree[i]
+		}
+		if st := Find(tree[i].Children, id); st != nil {
+			return st
+		}
+	}
+	return nil
+}
+
+// Reopen clears the completion state of nodes and everything below them.
+func Reopen(nodes []Subtask) {
+	for i := range nodes {
+		nodes[i].Completed = false
+		nodes[i].CompletedAt = nil
+		Reopen(nodes[i].Children)
+	}
+}
+
+// Size counts nodes and everything below them.
+func Size(nodes []Subtask) int {
+	n := len(nodes)
+	for _, st := range nodes {
+		n += Size(st.Children)
+	}
+	return n
+}
+
+// Descendants returns the ids below id in flat, nearest first.
+func Descendants(flat []Subtask, id int64) []int64 {
+	var out []int64
+	queue := []int64{id}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, st := range flat {
+			if st.ParentID != nil && *st.ParentID == cur {
+				out = append(out, st.ID)
+				queue = append(queue, st.ID)
+			}
+		}
+	}
+	return out
+}
+
+// CompletionChanges works out which subtasks change state when id is set to
+// completed. Completing a subtask completes its whole branch, and with
+// completeParent also every ancestor whose children are then all done.
+// Reopening a subtask reopens its completed ancestors, since a parent cannot
+// be done while one of its children is not. The result maps each subtask whose
+// state differs from flat to its new state.
+func CompletionChanges(flat []Subtask, id int64, completed, completeParent bool) map[int64]bool {
+	state := make(map[int64]bool, len(flat))
+	parent := make(map[int64]*int64, len(flat))
+	for _, st := range flat {
+		state[st.ID] = st.Completed
+		parent[st.ID] = st.ParentID
+	}
+	if _, ok := state[id]; !ok {
+		return nil
+	}
+	next := map[int64]bool{id: completed}
+	if completed {
+		for _, d := range Descendants(flat, id) {
+			next[d] = true
+		}
+		for p := parent[id]; completeParent && p != nil; p = parent[*p] {
+			if !allDone(flat, *p, state, next) {
+				break
+			}
+			next[*p] = true
+		}
+	} else {
+		for p := parent[id]; p != nil; p = parent[*p] {
+			next[*p] = false
+		}
+	}
+	changes := map[int64]bool{}
+	for k, v := range next {
+		if state[k] != v {
+			changes[k] = v
+		}
+	}
+	return changes
+}
+
+func allDone(flat []Subtask, parent int64, state, next map[int64]bool) bool {
+	for _, st := range flat {
+		if st.ParentID == nil || *st.ParentID != parent {
+			continue
+		}
+		done, ok := next[st.ID]
+		if !ok {
+			done = state[st.ID]
+		}
+		if !done {
+			return false
+		}
+	}
+	return true
+}
+
+// SortedIDs returns the keys of changes in ascending order.
+func SortedIDs(changes map[int64]bool) []int64 {
+	ids := make([]int64, 0, len(changes))
+	for id := range changes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Flat loads the live subtasks of one todo without nesting them.
+func Flat(ctx context.Context, q db.Querier, todoID int64) ([]Subtask, error) {
+	rows, err := q.Query(ctx, "SELECT "+subtaskColumns+" FROM subtasks WHERE todo_id=$1 AND deleted_at IS NULL ORDER BY position, id", todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Subtask{}
+	for rows.Next() {
+		var st Subtask
+		var tid int64
+		if err := scanSubtask(rows, &st, &tid); err != nil {
+			return nil, err
+		}
+		list = append(list, st)
+	}
+	return list, rows.Err()
+}
+
+// branch selects a subtask and everything below it.
+const branch = "WITH RECURSIVE branch AS (SELECT id FROM subtasks WHERE id=$1 UNION ALL SELECT s.id FROM subtasks s JOIN branch b ON s.parent_id=b.id) "
+
+// TrashSubtask moves the live part of a subtask's branch to the trash, stamped
+// with at so that RestoreSubtask can later bring the branch back as a whole.
+func TrashSubtask(ctx context.Context, q db.Querier, id int64, at time.Time) (int64, error) {
+	tag, err := q.Exec(ctx, branch+"UPDATE subtasks SET deleted_at=$2 WHERE id IN (SELECT id FROM branch) AND deleted_at IS NULL", id, at)
+	return tag.RowsAffected(), err
+}
+
+// RestoreSubtask restores a trashed subtask and the descendants that were
+// trashed along with it. Descendants deleted on their own stay in the trash.
+func RestoreSubtask(ctx context.Context, q db.Querier, id int64) (int64, error) {
+	tag, err := q.Exec(ctx, branch+"UPDATE subtasks SET deleted_at=NULL WHERE id IN (SELECT id FROM branch) AND deleted_at=(SELECT deleted_at FROM subtasks WHERE id=$1)", id)
+	return tag.RowsAffected(), err
+}
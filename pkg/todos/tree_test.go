@@ -0,0 +1,113 @@
+package todos
+
+import (
+	"reflect"
+	"testing"
+)
+
+func ptr(v int64) *int64 { return &v }
+
+// 1
+// ├── 2
+// │   ├── 4
+// │   └── 5
+// └── 3
+// 6
+func sample() []Subtask {
+	return []Subtask{
+		{ID: 1},
+		{ID: 2, ParentID: ptr(1)},
+		{ID: 3, ParentID: ptr(1), Completed: true},
+		{ID: 4, ParentID: ptr(2)},
+		{ID: 5, ParentID: ptr(2), Completed: true},
+		{ID: 6},
+	}
+}
+
+func ids(list []Subtask) []int64 {
+	var out []int64
+	for _, st := range list {
+		out = append(out, st.ID)
+	}
+	return out
+}
+
+func TestBuildTree(t *testing.T) {
+	tree := BuildTree(sample())
+	if !reflect.DeepEqual(ids(tree), []int64{1, 6}) {
+		t.Fatalf("roots = %v", ids(tree))
+	}
+	if !reflect.DeepEqual(ids(tree[0].Children), []int64{2, 3}) {
+		t.Fatalf("children of 1 = %v", ids(tree[0].Children))
+	}
+	if !reflect.DeepEqual(ids(tree[0].Children[0].Children), []int64{4, 5}) {
+		t.Fatalf("children of 2 = %v", ids(tree[0].Children[0].Children))
+	}
+	// Without 2 (trashed) its branch disappears.
+	flat := sample()
+	flat = append(flat[:1], flat[2:]...)
+	tree = BuildTree(flat)
+	if !reflect.DeepEqual(ids(tree[0].Children), []int64{3}) {
+		t.Fatalf("children of 1 without 2 = %v", ids(tree[0].Children))
+	}
+}
+
+func TestDescendants(t *testing.T) {
+	if d := Descendants(sample(), 1); !reflect.DeepEqual(d, []int64{2, 3, 4, 5}) {
+		t.Fatalf("descendants of 1 = %v", d)
+	}
+	if d := Descendants(sample(), 6); d != nil {
+		t.Fatalf("descendants of 6 = %v", d)
+	}
+}
+
+func TestCompletionChanges(t *testing.T) {
+	cases := []struct {
+		name           string
+		id             int64
+		completed      bool
+		completeParent bool
+		want           map[int64]bool
+	}{
+		{"complete branch", 2, true, false, map[int64]bool{2: true, 4: true}},
+		{"complete leaf", 4, true, false, map[int64]bool{4: true}},
+		{"complete leaf and parents", 4, true, true, map[int64]bool{4: true, 2: true, 1: true}},
+		{"reopen leaf", 5, false, false, map[int64]bool{5: false}},
+		{"already done", 3, true, true, map[int64]bool{}},
+		{"unknown", 9, true, false, nil},
+	}
+	for _, c := range cases {
+		got := CompletionChanges(sample(), c.id, c.completed, c.completeParent)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	// Reopening a child of a finished branch reopens its ancestors.
+	done := sample()
+	for i := range done {
+		done[i].Completed = true
+	}
+	got := CompletionChanges(done, 4, false, false)
+	if want := map[int64]bool{4: false, 2: false, 1: false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reopen in done tree: got %v, want %v", got, want)
+	}
+}
+
+func TestFindReopenSize(t *testing.T) {
+	tree := BuildTree(sample())
+	if Size(tree) != 6 {
+		t.Errorf("Size = %d", Size(tree))
+	}
+	st := Find(tree, 2)
+	if st == nil || !reflect.DeepEqual(ids(st.Children), []int64{4, 5}) {
+		t.Fatalf("Find(2) = %+v", st)
+	}
+	if Find(tree, 9) != nil {
+		t.Error("Find(9) found something")
+	}
+	Reopen(tree)
+	if Find(tree, 5).Completed || Find(tree, 3).Completed {
+		t.Error("Reopen left completed subtasks")
+	}
+}
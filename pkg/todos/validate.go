@@ -0,0 +1,99 @@
+package todos
+
+import (
+	"fmt"
+	"strings"
+
+	"chronos-task-manager/pkg/validate"
+)
+
+// Limits on todo and subtask input.
+const (
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 5000
+	MaxTags              = 20
+	MaxTagLength         = 50
+	MaxEstimateMinutes   = 24 * 60
+)
+
+// Groups are the group ids a todo can belong to, matching GROUPS in the
+// frontend's constants.ts.
+var Groups = []string{"personal", "work", "learning", "health"}
+
+// Rules for the fields a todo shares with subtasks and templates.
+var (
+	TitleRules       = []validate.Rule{validate.Required, validate.MaxLength(MaxTitleLength)}
+	DescriptionRules = []validate.Rule{validate.MaxLength(MaxDescriptionLength)}
+	GroupRules       = []validate.Rule{validate.Required, validate.OneOf(Groups...)}
+	TagRules         = []validate.Rule{validate.MaxLength(MaxTagLength)}
+)
+
+// Validate trims the todo's titles and checks a todo about to be created,
+// subtasks included. The error is validate.Errors.
+func (t *Todo) Validate() error {
+	var errs validate.Errors
+	t.Title = strings.TrimSpace(t.Title)
+	errs.String("title", t.Title, TitleRules...)
+	errs.String("description", t.Description, DescriptionRules...)
+	errs.String("date", t.Date, validate.Required, validate.Date)
+	errs.String("time", t.Time, validate.Time)
+	errs.String("groupId", t.GroupID, GroupRules...)
+	if t.Deadline != nil {
+		errs.String("deadline", *t.Deadline, validate.Date)
+	}
+	if t.DeferUntil != nil {
+		errs.String("deferUntil", *t.DeferUntil, validate.Date)
+	}
+	if t.ProjectID != nil && *t.ProjectID <= 0 {
+		errs.Add("projectId", validate.CodeRange, "must be a positive id")
+	}
+	if t.EstimateMinutes != nil {
+		errs.Int("estimateMinutes", int64(*t.EstimateMinutes), 0, MaxEstimateMinutes)
+	}
+	checkTags(&errs, t.Tags)
+	checkSubtasks(&errs, "subtasks", t.Subtasks)
+	return errs.Err()
+}
+
+func checkTags(errs *validate.Errors, tags []string) {
+	if len(tags) > MaxTags {
+		errs.Add("tags", validate.CodeTooLong, fmt.Sprintf("must have at most %d tags", MaxTags))
+	}
+	for i, tag := range tags {
+		errs.String(fmt.Sprintf("tags[%d]", i), tag, TagRules...)
+	}
+}
+
+// checkSubtasks trims and checks the titles of a subtask tree and its size.
+func checkSubtasks(errs *validate.Errors, field string, nodes []Subtask) {
+	if Size(nodes) > MaxSubtasks {
+		errs.Add(field, validate.CodeTooLong, fmt.Sprintf("must have at most %d subtasks", MaxSubtasks))
+		return
+	}
+	var walk func(prefix string, nodes []Subtask)
+	walk = func(prefix string, nodes []Subtask) {
+		for i := range nodes {
+			name := fmt.Sprintf("%s[%d]", prefix, i)
+			nodes[i].Title = strings.TrimSpace(nodes[i].Title)
+			errs.String(name+".title", nodes[i].Title, TitleRules...)
+			walk(name+".children", nodes[i].Children)
+		}
+	}
+	walk(field, nodes)
+}
+
+// ValidateSubtasks checks a subtask tree on its own, as when a checklist is
+// replaced.
+func ValidateSubtasks(nodes []Subtask) error {
+	var errs validate.Errors
+	checkSubtasks(&errs, "subtasks", nodes)
+	return errs.Err()
+}
+
+// ValidateSubtaskTitle trims and checks the title of a new subtask.
+func ValidateSubtaskTitle(title *string) error {
+	var errs validate.Errors
+	*title = strings.TrimSpace(*title)
+	errs.String("title", *title, TitleRules...)
+	return errs.Err()
+}
@@ -0,0 +1,51 @@
+package todos
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"chronos-task-manager/pkg/validate"
+)
+
+func TestValidate(t *testing.T) {
+	ok := &Todo{Title: " Report ", Date: "2025-01-02", GroupID: "work", Subtasks: []Subtask{{Title: " a "}}}
+	if err := ok.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if ok.Title != "Report" || ok.Subtasks[0].Title != "a" {
+		t.Errorf("titles not trimmed: %q %q", ok.Title, ok.Subtasks[0].Title)
+	}
+
+	est := -5
+	deadline := "banana"
+	bad := &Todo{
+		Title:           "  ",
+		Description:     strings.Repeat("x", MaxDescriptionLength+1),
+		Date:            "banana",
+		Time:            "9am",
+		GroupID:         "play",
+		Deadline:        &deadline,
+		EstimateMinutes: &est,
+		Tags:            []string{"ok", strings.Repeat("t", MaxTagLength+1)},
+		Subtasks:        []Subtask{{Title: "a", Children: []Subtask{{Title: ""}}}},
+	}
+	var fields []string
+	for _, fe := range bad.Validate().(validate.Errors) {
+		fields = append(fields, fe.Field+"="+fe.Code)
+	}
+	want := []string{
+		"date=invalid_format",
+		"deadline=invalid_format",
+		"description=too_long",
+		"estimateMinutes=out_of_range",
+		"groupId=unknown_value",
+		"subtasks[0].children[0].title=required",
+		"tags[1]=too_long",
+		"time=invalid_format",
+		"title=required",
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields = %v", fields)
+	}
+}
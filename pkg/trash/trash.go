@@ -0,0 +1,82 @@
+package trash
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"chronos-task-manager/pkg/attachments"
+	"chronos-task-manager/pkg/db"
+)
+
+// DefaultRetentionDays is how long deleted todos and subtasks stay in the
+// trash when TRASH_RETENTION_DAYS is not set.
+const DefaultRetentionDays = 30
+
+// Retention returns how long trashed items are kept before being purged.
+func Retention() time.Duration {
+	return parseRetention(os.Getenv("TRASH_RETENTION_DAYS"))
+}
+
+func parseRetention(s string) time.Duration {
+	days, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || days <= 0 {
+		days = DefaultRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// PurgeAt returns when an item deleted at deletedAt will be purged.
+func PurgeAt(deletedAt time.Time) time.Time {
+	return deletedAt.Add(Retention())
+}
+
+// Purge permanently removes todos and subtasks that were moved to the trash
+// before cutoff, as DropTodos does. Run it in a transaction and remove the
+// returned attachment keys once it commits.
+func Purge(ctx context.Context, q db.Querier, cutoff time.Time) (todos, subtasks int64, keys []string, err error) {
+	tag, err := q.Exec(ctx, "DELETE FROM subtasks WHERE deleted_at IS NOT NULL AND deleted_at < $1", cutoff)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	subtasks = tag.RowsAffected()
+	todos, keys, err = DropTodos(ctx, q, "deleted_at < $1", cutoff)
+	return todos, subtasks, keys, err
+}
+
+// DropTodos permanently deletes the trashed todos matching where. They are
+// locked first, so a concurrent restore either lands before and keeps the
+// todo out of the delete, or waits and finds nothing to restore. Subtasks go
+// with their todo through the foreign key; attachment rows are deleted here
+// and their storage keys returned, to be removed once q's transaction
+// commits.
+func DropTodos(ctx context.Context, q db.Querier, where string, args ...any) (int64, []string, error) {
+	rows, err := q.Query(ctx, "SELECT id FROM todos WHERE deleted_at IS NOT NULL AND "+where+" FOR UPDATE", args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(ids) == 0 {
+		return 0, nil, err
+	}
+	keys, err := attachments.DeleteRows(ctx, q, "todo_id = ANY($1)", ids)
+	if err != nil {
+		return 0, nil, err
+	}
+	tag, err := q.Exec(ctx, "DELETE FROM todos WHERE id = ANY($1)", ids)
+	if err != nil {
+		return 0, nil, err
+	}
+	return tag.RowsAffected(), keys, nil
+}
@@ -0,0 +1,23 @@
+package trash
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRetention(t *testing.T) {
+	day := 24 * time.Hour
+	cases := map[string]time.Duration{
+		"":      DefaultRetentionDays * day,
+		"7":     7 * day,
+		" 14 ":  14 * day,
+		"0":     DefaultRetentionDays * day,
+		"-3":    DefaultRetentionDays * day,
+		"weeks": DefaultRetentionDays * day,
+	}
+	for in, want := range cases {
+		if got := parseRetention(in); got != want {
+			t.Fatalf("parseRetention(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package validate checks request input field by field. Inputs are described
+// as a list of rules per field, and every failing field is reported with a
+// stable code so that clients can show their own messages:
+//
+//	var errs validate.Errors
+//	errs.String("title", in.Title, validate.Required, validate.MaxLength(200))
+//	errs.String("date", in.Date, validate.Required, validate.Date)
+//	if err := errs.Err(); err != nil { ... }
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Codes of the problems a field can have.
+const (
+	CodeRequired     = "required"
+	CodeTooShort     = "too_short"
+	CodeTooLong      = "too_long"
+	CodeFormat       = "invalid_format"
+	CodeType         = "invalid_type"
+	CodeRange        = "out_of_range"
+	CodeUnknownValue = "unknown_value"
+	CodeUnknownField = "unknown_field"
+	CodeInvalid      = "invalid"
+)
+
+// FieldError is one invalid field. Nested fields are named like
+// subtasks[0].children[1].title.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors collects the invalid fields of one input.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Add records a problem with field.
+func (e *Errors) Add(field, code, msg string) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: msg})
+}
+
+// Has reports whether a problem with field is already recorded.
+func (e Errors) Has(field string) bool {
+	for _, fe := range e {
+		if fe.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the problems sorted by field, or nil when there are none.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	sort.SliceStable(e, func(i, j int) bool { return e[i].Field < e[j].Field })
+	return e
+}
+
+// Rule checks a string and returns a code and message when it is invalid.
+// Every rule but Required accepts the empty string, so leaving Required out
+// makes a field optional.
+type Rule func(s string) (code, msg string)
+
+// String checks value against rules in order and records the first failure.
+// It reports whether value passed.
+func (e *Errors) String(field, value string, rules ...Rule) bool {
+	for _, rule := range rules {
+		if code, msg := rule(value); code != "" {
+			e.Add(field, code, msg)
+			return false
+		}
+	}
+	return true
+}
+
+// Int records a problem when n is outside [min, max].
+func (e *Errors) Int(field string, n, min, max int64) bool {
+	if n < min || n > max {
+		e.Add(field, CodeRange, fmt.Sprintf("must be between %d and %d", min, max))
+		return false
+	}
+	return true
+}
+
+// Required rejects blank strings.
+func Required(s string) (string, string) {
+	if strings.TrimSpace(s) == "" {
+		return CodeRequired, "is required"
+	}
+	return "", ""
+}
+
+// MinLength rejects strings shorter than n characters.
+func MinLength(n int) Rule {
+	return func(s string) (string, string) {
+		if s != "" && utf8.RuneCountInString(s) < n {
+			return CodeTooShort, fmt.Sprintf("must be at least %d characters", n)
+		}
+		return "", ""
+	}
+}
+
+// MaxLength rejects strings longer than n characters.
+func MaxLength(n int) Rule {
+	return func(s string) (string, string) {
+		if utf8.RuneCountInString(s) > n {
+			return CodeTooLong, fmt.Sprintf("must be at most %d characters", n)
+		}
+		return "", ""
+	}
+}
+
+// Layout accepts strings that parse as a time.Parse layout, described to
+// the client as format.
+func Layout(layout, format string) Rule {
+	return func(s string) (string, string) {
+		if s == "" {
+			return "", ""
+		}
+		if _, err := time.Parse(layout, s); err != nil {
+			return CodeFormat, "must be " + format
+		}
+		return "", ""
+	}
+}
+
+// Formats of dates and times in requests.
+var (
+	Date  = Layout("2006-01-02", "YYYY-MM-DD")
+	Time  = Layout("15:04", "HH:MM")
+	Month = Layout("2006-01", "YYYY-MM")
+)
+
+// Email accepts a bare address such as name@example.com.
+func Email(s string) (string, string) {
+	if s == "" {
+		return "", ""
+	}
+	a, err := mail.ParseAddress(s)
+	if err != nil || a.Address != s || !strings.Contains(s[strings.LastIndex(s, "@")+1:], ".") {
+		return CodeFormat, "must be an email address"
+	}
+	return "", ""
+}
+
+// OneOf accepts only the given values.
+func OneOf(values ...string) Rule {
+	return func(s string) (string, string) {
+		if s == "" {
+			return "", ""
+		}
+		for _, v := range values {
+			if s == v {
+				return "", ""
+			}
+		}
+		return CodeUnknownValue, "must be one of " + strings.Join(values, ", ")
+	}
+}
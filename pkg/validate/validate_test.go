@@ -0,0 +1,69 @@
+package validate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	cases := []struct {
+		rule  Rule
+		value string
+		code  string
+	}{
+		{Required, "", CodeRequired},
+		{Required, "  ", CodeRequired},
+		{Required, "a", ""},
+		{MinLength(3), "ab", CodeTooShort},
+		{MinLength(3), "", ""},
+		{MaxLength(3), "abcd", CodeTooLong},
+		{MaxLength(3), "日本語", ""},
+		{Date, "2025-02-30", CodeFormat},
+		{Date, "banana", CodeFormat},
+		{Date, "2025-02-28", ""},
+		{Date, "", ""},
+		{Time, "24:00", CodeFormat},
+		{Time, "09:30", ""},
+		{Month, "2025-1", CodeFormat},
+		{Month, "2025-01", ""},
+		{Email, "a@example.com", ""},
+		{Email, "A <a@example.com>", CodeFormat},
+		{Email, "a@localhost", CodeFormat},
+		{Email, "nope", CodeFormat},
+		{OneOf("work", "health"), "play", CodeUnknownValue},
+		{OneOf("work", "health"), "work", ""},
+	}
+	for i, c := range cases {
+		if code, _ := c.rule(c.value); code != c.code {
+			t.Errorf("case %d (%q): code = %q, want %q", i, c.value, code, c.code)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var errs Errors
+	if errs.Err() != nil {
+		t.Fatal("empty Errors should be nil")
+	}
+	if !errs.String("title", "ok", Required, MaxLength(5)) {
+		t.Error("valid title rejected")
+	}
+	errs.String("title", strings.Repeat("x", 6), Required, MaxLength(5))
+	errs.String("date", "", Required, Date)
+	errs.Int("estimateMinutes", -1, 0, 10)
+	want := Errors{
+		{Field: "date", Code: CodeRequired, Message: "is required"},
+		{Field: "estimateMinutes", Code: CodeRange, Message: "must be between 0 and 10"},
+		{Field: "title", Code: CodeTooLong, Message: "must be at most 5 characters"},
+	}
+	if err := errs.Err(); !reflect.DeepEqual(err, want) {
+		t.Errorf("Err = %#v", err)
+	}
+	if !errs.Has("date") || errs.Has("time") {
+		t.Error("Has")
+	}
+	if got := errs.Error(); !strings.HasPrefix(got, "date: is required; ") {
+		t.Errorf("Error = %q", got)
+	}
+}
@@ -0,0 +1,265 @@
+// Package views stores saved views: a named filter in the query language
+// with an optional sort and grouping, evaluated against the user's todos.
+package views
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"chronos-task-manager/pkg/db"
+	"chronos-task-manager/pkg/query"
+	"chronos-task-manager/pkg/todos"
+)
+
+// Values of GroupBy. Todos are grouped on the page in the order they are
+// sorted in, so the grouping field always sorts first.
+const (
+	GroupNone    = ""
+	GroupGroup   = "group"
+	GroupProject = "project"
+	GroupDate    = "date"
+	GroupDue     = "due"
+)
+
+const MaxNameLength = 100
+
+type View struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	Sort      string    `json:"sort"`
+	GroupBy   string    `json:"groupBy"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Validate trims the name and checks that the query and sort parse.
+func (v *View) Validate() error {
+	v.Name = strings.TrimSpace(v.Name)
+	if v.Name == "" {
+		return errors.New("name is required")
+	}
+	if utf8.RuneCountInString(v.Name) > MaxNameLength {
+		return fmt.Errorf("name is longer than %d characters", MaxNameLength)
+	}
+	switch v.GroupBy {
+	case GroupNone, GroupGroup, GroupProject, GroupDate, GroupDue:
+	default:
+		return fmt.Errorf("groupBy must be one of %s, %s, %s or %s", GroupGroup, GroupProject, GroupDate, GroupDue)
+	}
+	_, err := v.Plan()
+	return err
+}
+
+// Plan is a view ready to run.
+type Plan struct {
+	Query *query.Query
+	Sort  []query.SortKey
+}
+
+// Plan parses the view. The sort is the view's own, else the one in its
+// query, else by date; the grouping field is moved to the front.
+func (v View) Plan() (Plan, error) {
+	q, err := query.Parse(v.Query)
+	if err != nil {
+		return Plan{}, err
+	}
+	keys, err := query.ParseSort(v.Sort)
+	if err != nil {
+		return Plan{}, fmt.Errorf("sort: %w", err)
+	}
+	if len(keys) == 0 {
+		keys = q.Sort
+	}
+	if len(keys) == 0 {
+		keys = []query.SortKey{{Field: "date"}}
+	}
+	if v.GroupBy != GroupNone {
+		first := query.SortKey{Field: v.GroupBy}
+		rest := make([]query.SortKey, 0, len(keys))
+		for _, k := range keys {
+			if k.Field == v.GroupBy {
+				first.Desc = k.Desc
+			} else {
+				rest = append(rest, k)
+			}
+		}
+		keys = append([]query.SortKey{first}, rest...)
+	}
+	return Plan{Query: q, Sort: keys}, nil
+}
+
+// Where returns the condition on todos selecting the view's todos, with
+// placeholders from $n. Like the todo list, it leaves out deferred todos
+// unless the query asks about them.
+func (p Plan) Where(today string, n int) (string, []interface{}) {
+	cond, args := p.Query.Where(query.Options{Today: today}, n)
+	if !p.Query.Uses("deferred") && !p.Query.Uses("defer") {
+		args = append(args, today)
+		hide := fmt.Sprintf("(defer_until IS NULL OR defer_until<=$%d::date)", n+len(args)-1)
+		if cond == "" {
+			cond = hide
+		} else {
+			cond += " AND " + hide
+		}
+	}
+	return cond, args
+}
+
+// Group is a run of todos on a page sharing the grouping field's value.
+type Group struct {
+	Key     interface{} `json:"key"`
+	TodoIDs []int64     `json:"todoIds"`
+}
+
+// Groups splits a sorted page into runs by groupBy. Todos without a
+// project or deadline have a null key.
+func Groups(groupBy string, list []todos.Todo) []Group {
+	out := []Group{}
+	var last string
+	for i, t := range list {
+		var key interface{}
+		var cmp string
+		switch groupBy {
+		case GroupGroup:
+			key, cmp = t.GroupID, t.GroupID
+		case GroupProject:
+			if t.ProjectID != nil {
+				key, cmp = *t.ProjectID, fmt.Sprint(*t.ProjectID)
+			}
+		case GroupDate:
+			key, cmp = t.Date, t.Date
+		case GroupDue:
+			if t.Deadline != nil {
+				key, cmp = *t.Deadline, *t.Deadline
+			}
+		default:
+			return nil
+		}
+		if i == 0 || cmp != last {
+			out = append(out, Group{Key: key})
+			last = cmp
+		}
+		g := &out[len(out)-1]
+		g.TodoIDs = append(g.TodoIDs, t.ID)
+	}
+	return out
+}
+
+const columns = "id,name,query,sort,group_by,position,created_at,updated_at"
+
+func scan(row interface{ Scan(...any) error }, v *View) error {
+	return row.Scan(&v.ID, &v.Name, &v.Query, &v.Sort, &v.GroupBy, &v.Position, &v.CreatedAt, &v.UpdatedAt)
+}
+
+// List returns the user's views in sidebar order.
+func List(ctx context.Context, q db.Querier, userID int64) ([]View, error) {
+	rows, err := q.Query(ctx, "SELECT "+columns+" FROM saved_views WHERE user_id=$1 ORDER BY position, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []View{}
+	for rows.Next() {
+		var v View
+		if err := scan(rows, &v); err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, rows.Err()
+}
+
+// Get returns one view. It returns pgx.ErrNoRows when the user has no view
+// with that id.
+func Get(ctx context.Context, q db.Querier, userID, id int64) (View, error) {
+	var v View
+	err := scan(q.QueryRow(ctx, "SELECT "+columns+" FROM saved_views WHERE user_id=$1 AND id=$2", userID, id), &v)
+	return v, err
+}
+
+// Create stores a new view at the end of the list.
+func Create(ctx context.Context, q db.Querier, userID int64, v View) (View, error) {
+	var out View
+	err := scan(q.QueryRow(ctx, "INSERT INTO saved_views(user_id,name,query,sort,group_by,position) VALUES($1,$2,$3,$4,$5,(SELECT COUNT(*) FROM saved_views WHERE user_id=$1)) RETURNING "+columns,
+		userID, v.Name, v.Query, v.Sort, v.GroupBy), &out)
+	return out, err
+}
+
+// Update replaces the name, query, sort and grouping of a view. It returns
+// pgx.ErrNoRows when there is no such view.
+func Update(ctx context.Context, q db.Querier, userID int64, v View) (View, error) {
+	var out View
+	err := scan(q.QueryRow(ctx, "UPDATE saved_views SET name=$3,query=$4,sort=$5,group_by=$6,updated_at=NOW() WHERE user_id=$1 AND id=$2 RETURNING "+columns,
+		userID, v.ID, v.Name, v.Query, v.Sort, v.GroupBy), &out)
+	return out, err
+}
+
+// ErrOrder is returned by Reorder when ids is not exactly the user's views.
+var ErrOrder = errors.New("ids must list every view exactly once")
+
+// Reorder sets the positions of the user's views to the order of ids.
+func Reorder(ctx context.Context, q db.Querier, userID int64, ids []int64) error {
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return ErrOrder
+		}
+		seen[id] = true
+	}
+	var total int
+	if err := q.QueryRow(ctx, "SELECT COUNT(*) FROM saved_views WHERE user_id=$1", userID).Scan(&total); err != nil {
+		return err
+	}
+	if total != len(ids) {
+		return ErrOrder
+	}
+	tag, err := q.Exec(ctx, "UPDATE saved_views v SET position=x.pos-1 FROM unnest($2::bigint[]) WITH ORDINALITY AS x(id,pos) WHERE v.user_id=$1 AND v.id=x.id", userID, ids)
+	if err != nil {
+		return err
+	}
+	if int(tag.RowsAffected()) != len(ids) {
+		return ErrOrder
+	}
+	return nil
+}
+
+// Counts returns, per view, how many open todos it matches, in one pass
+// over the user's todos. Views that no longer parse are left out.
+func Counts(ctx context.Context, q db.Querier, userID int64, list []View, today string) (map[int64]int64, error) {
+	out := map[int64]int64{}
+	args := []interface{}{userID}
+	var exprs []string
+	var ids []int64
+	for _, v := range list {
+		p, err := v.Plan()
+		if err != nil {
+			continue
+		}
+		cond, cargs := p.Where(today, len(args)+1)
+		args = append(args, cargs...)
+		exprs = append(exprs, "COUNT(*) FILTER (WHERE "+cond+")")
+		ids = append(ids, v.ID)
+	}
+	if len(exprs) == 0 {
+		return out, nil
+	}
+	counts := make([]int64, len(ids))
+	dest := make([]interface{}, len(ids))
+	for i := range counts {
+		dest[i] = &counts[i]
+	}
+	err := q.QueryRow(ctx, "SELECT "+strings.Join(exprs, ", ")+" FROM todos WHERE user_id=$1 AND deleted_at IS NULL AND NOT completed", args...).Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		out[id] = counts[i]
+	}
+	return out, nil
+}
@@ -0,0 +1,96 @@
+package views
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"chronos-task-manager/pkg/query"
+	"chronos-task-manager/pkg/todos"
+)
+
+func TestValidate(t *testing.T) {
+	ok := View{Name: "  Work today ", Query: "group:work due<=today", Sort: "-due", GroupBy: GroupProject}
+	if err := ok.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if ok.Name != "Work today" {
+		t.Errorf("Name = %q", ok.Name)
+	}
+	bad := []View{
+		{Name: " "},
+		{Name: strings.Repeat("x", MaxNameLength+1)},
+		{Name: "a", GroupBy: "tag"},
+		{Name: "a", Query: "is:open (x"},
+		{Name: "a", Sort: "priority"},
+		{Name: "a", Sort: "due,-due"},
+	}
+	for _, v := range bad {
+		if err := v.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil", v)
+		}
+	}
+}
+
+func TestPlanSort(t *testing.T) {
+	cases := []struct {
+		view View
+		want []query.SortKey
+	}{
+		{View{}, []query.SortKey{{Field: "date"}}},
+		{View{Query: "sort:-estimate"}, []query.SortKey{{Field: "estimate", Desc: true}}},
+		{View{Query: "sort:-estimate", Sort: "title"}, []query.SortKey{{Field: "title"}}},
+		{View{GroupBy: GroupProject}, []query.SortKey{{Field: "project"}, {Field: "date"}}},
+		{View{Sort: "title,-due", GroupBy: GroupDue}, []query.SortKey{{Field: "due", Desc: true}, {Field: "title"}}},
+	}
+	for _, c := range cases {
+		p, err := c.view.Plan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(p.Sort, c.want) {
+			t.Errorf("Plan(%+v).Sort = %v, want %v", c.view, p.Sort, c.want)
+		}
+	}
+}
+
+func TestPlanWhereHidesDeferred(t *testing.T) {
+	p, _ := View{Query: "tag:home"}.Plan()
+	cond, args := p.Where("2025-05-01", 2)
+	if cond != "COALESCE($2=ANY(tags),false) AND (defer_until IS NULL OR defer_until<=$3::date)" {
+		t.Errorf("cond = %s", cond)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"home", "2025-05-01"}) {
+		t.Errorf("args = %v", args)
+	}
+	p, _ = View{}.Plan()
+	if cond, _ := p.Where("2025-05-01", 1); cond != "(defer_until IS NULL OR defer_until<=$1::date)" {
+		t.Errorf("empty cond = %s", cond)
+	}
+	p, _ = View{Query: "is:deferred"}.Plan()
+	if cond, _ := p.Where("2025-05-01", 1); strings.Contains(cond, "IS NULL") {
+		t.Errorf("deferred view still hides deferred todos: %s", cond)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	p1 := int64(4)
+	due := "2025-06-01"
+	list := []todos.Todo{
+		{ID: 1, ProjectID: &p1, Deadline: &due},
+		{ID: 2, ProjectID: &p1},
+		{ID: 3},
+		{ID: 4},
+	}
+	want := []Group{{Key: int64(4), TodoIDs: []int64{1, 2}}, {Key: nil, TodoIDs: []int64{3, 4}}}
+	if got := Groups(GroupProject, list); !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups(project) = %+v", got)
+	}
+	want = []Group{{Key: "2025-06-01", TodoIDs: []int64{1}}, {Key: nil, TodoIDs: []int64{2, 3, 4}}}
+	if got := Groups(GroupDue, list); !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups(due) = %+v", got)
+	}
+	if got := Groups(GroupNone, list); got != nil {
+		t.Errorf("Groups(none) = %+v", got)
+	}
+}
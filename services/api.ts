@@ -34,14 +34,24 @@ function authHeaders(token: string) {
   return { 'Authorization': `Bearer ${token}`, 'Content-Type': 'application/json' };
 }
 
+// The list endpoint is paginated; follow nextCursor so a busy day is never
+// cut off.
 export async function getTodos(date: string, token: string) {
-  const res = await fetch(`/chronos/api/todos?date=${encodeURIComponent(date)}`, {
-    headers: authHeaders(token)
-  });
-  let data: any = null;
-  try { data = await res.json(); } catch {}
-  if (!res.ok) return { ok: false, error: data?.error || `HTTP ${res.status}` };
-  return data;
+  const todos: any[] = [];
+  let cursor = '';
+  do {
+    const params = new URLSearchParams({ date, limit: '500' });
+    if (cursor) params.set('cursor', cursor);
+    const res = await fetch(`/chronos/api/todos?${params}`, {
+      headers: authHeaders(token)
+    });
+    let data: any = null;
+    try { data = await res.json(); } catch {}
+    if (!res.ok) return { ok: false, error: data?.error || `HTTP ${res.status}` };
+    todos.push(...(data?.data || []));
+    cursor = data?.page?.nextCursor || '';
+  } while (cursor);
+  return { ok: true, data: todos };
 }
 
 export async function createTodo(payload: { title: string; description?: string; date: string; time?: string; groupId: string; subtasks?: { title: string; completed?: boolean }[] }, token: string) {
@@ -56,11 +66,11 @@ export async function createTodo(payload: { title: string; description?: string;
   return data;
 }
 
-export async function toggleTodo(id: string, token: string) {
+export async function setTodoCompleted(id: string, completed: boolean, token: string) {
   const res = await fetch('/chronos/api/todos', {
     method: 'PATCH',
     headers: authHeaders(token),
-    body: JSON.stringify({ id })
+    body: JSON.stringify({ id, completed })
   });
   let data: any = null;
   try { data = await res.json(); } catch {}
@@ -100,11 +110,11 @@ export async function updateTodo(payload: { id: string; title?: string; descript
   return data;
 }
 
-export async function toggleSubtask(id: string, token: string) {
+export async function setSubtaskCompleted(id: string, completed: boolean, token: string) {
   const res = await fetch('/chronos/api/subtasks', {
     method: 'PATCH',
     headers: authHeaders(token),
-    body: JSON.stringify({ id })
+    body: JSON.stringify({ id, completed })
   });
   let data: any = null;
   try { data = await res.json(); } catch {}
@@ -7,8 +7,13 @@ export interface Group {
 
 export interface SubTask {
   id: string;
+  parentId?: number;
+  position?: number;
   title: string;
   completed: boolean;
+  completedAt?: string;
+  version?: number;
+  children?: SubTask[];
 }
 
 export interface Task {
@@ -18,7 +23,19 @@ export interface Task {
   date: string; // YYYY-MM-DD
   time?: string; // HH:MM optional
   groupId: string;
+  projectId?: number;
+  estimateMinutes?: number;
+  deadline?: string;
+  deferUntil?: string;
+  customFields?: Record<string, string | number | boolean>;
   completed: boolean;
+  completedAt?: string;
+  tags?: string[];
+  version?: number;
+  trackedSeconds?: number;
+  commentCount?: number;
+  rolloverCount?: number;
+  rolledOverTo?: number;
   subtasks?: SubTask[];
 }
 